@@ -0,0 +1,158 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/rodolfoviolla/go-blockchain/handler"
+)
+
+var (
+	addrIndexKey = []byte("addrindex")
+	addrIndexPrefix = []byte("addr-")
+)
+
+// AddressTx is one entry of an address history: the coins a transaction paid
+// to the address, or took from it when Sent is set.
+type AddressTx struct {
+	TxID []byte
+	Height int
+	Sent bool
+	Amount int
+}
+
+func (entry AddressTx) Serialize() []byte {
+	encoder := NewEncoder()
+	encoder.WriteBytes(entry.TxID)
+	encoder.WriteInt(entry.Height)
+	encoder.WriteBool(entry.Sent)
+	encoder.WriteInt(entry.Amount)
+	return encoder.Bytes()
+}
+
+func DeserializeAddressTx(data []byte) AddressTx {
+	var entry AddressTx
+	decoder := NewDecoder(data)
+	entry.TxID = decoder.ReadBytes()
+	entry.Height = decoder.ReadInt()
+	entry.Sent = decoder.ReadBool()
+	entry.Amount = decoder.ReadInt()
+	handler.ErrorHandler(decoder.Finish())
+	return entry
+}
+
+// Entries are keyed by address, then height, so that a prefix scan returns an
+// address history oldest first.
+func addressKey(pubKeyHash []byte, entry *AddressTx) []byte {
+	key := append(append([]byte{}, addrIndexPrefix...), pubKeyHash...)
+	key = append(key, ToHex(int64(entry.Height))...)
+	key = append(key, entry.TxID...)
+	if entry.Sent {
+		return append(key, 1)
+	}
+	return append(key, 0)
+}
+
+func addrIndexEnabled(db *badger.DB) bool {
+	return db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(addrIndexKey)
+		return err
+	}) == nil
+}
+
+func (chain *BlockChain) AddrIndexEnabled() bool {
+	return chain.addrIndex
+}
+
+// addressEntries sums what every transaction of the block received and spent
+// per address, keyed by the index key of each entry. Outputs spent from earlier
+// blocks are looked up in the undo record of the block.
+func addressEntries(block *Block, undo BlockUndo) (map[string]AddressTx, error) {
+	entries := make(map[string]AddressTx)
+	outputs := make(map[string]TxOutput)
+	for _, spent := range undo.Spent {
+		outputs[string(unspentOutputKey(spent.TxID, spent.Index))] = spent.Output.TxOutput
+	}
+	add := func(pubKeyHash []byte, tx *Transaction, sent bool, amount int) {
+		entry := AddressTx{tx.ID, block.Height, sent, 0}
+		key := string(addressKey(pubKeyHash, &entry))
+		entry.Amount = entries[key].Amount + amount
+		entries[key] = entry
+	}
+	for _, tx := range block.Transactions {
+		if !tx.IsCoinbase() {
+			for _, in := range tx.Inputs {
+				out, ok := outputs[string(unspentOutputKey(in.ID, in.Out))]
+				if !ok {
+					return nil, fmt.Errorf("undo record of block %x has no output %x:%d", block.Hash, in.ID, in.Out)
+				}
+				add(out.PubKeyHash, tx, true, out.Value)
+			}
+		}
+		for index, out := range tx.Outputs {
+			outputs[string(unspentOutputKey(tx.ID, index))] = out
+			add(out.PubKeyHash, tx, false, out.Value)
+		}
+	}
+	return entries, nil
+}
+
+func indexAddresses(txn *badger.Txn, block *Block, undo BlockUndo) int {
+	entries := handler.ErrorHandler(addressEntries(block, undo))
+	for key, entry := range entries {
+		handler.ErrorHandler(txn.Set([]byte(key), entry.Serialize()))
+	}
+	return len(entries)
+}
+
+func unindexAddresses(txn *badger.Txn, block *Block, undo BlockUndo) {
+	entries := handler.ErrorHandler(addressEntries(block, undo))
+	for key := range entries {
+		handler.ErrorHandler(txn.Delete([]byte(key)))
+	}
+}
+
+// AddressHistory returns up to limit entries of the address history, oldest
+// first, after skipping offset of them, along with the total number of entries.
+func (chain *BlockChain) AddressHistory(pubKeyHash []byte, offset, limit int) ([]AddressTx, int) {
+	var history []AddressTx
+	total := 0
+	prefix := append(append([]byte{}, addrIndexPrefix...), pubKeyHash...)
+	handler.ErrorHandler(chain.Database.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		iterator := txn.NewIterator(opts)
+		defer iterator.Close()
+		for iterator.Seek(prefix); iterator.ValidForPrefix(prefix); iterator.Next() {
+			if total >= offset && len(history) < limit {
+				entry := DeserializeAddressTx(handler.ErrorHandler(iterator.Item().ValueCopy(nil)))
+				history = append(history, entry)
+			}
+			total++
+		}
+		return nil
+	}))
+	return history, total
+}
+
+// ReindexAddresses rebuilds the address index from the main chain blocks and
+// their undo records, and turns on indexing of the blocks connected after it.
+func (chain *BlockChain) ReindexAddresses() int {
+	unspentTxOutputsSet := UnspentTxOutputsSet{chain}
+	unspentTxOutputsSet.DeleteByPrefix(addrIndexPrefix)
+	count := 0
+	for height := 0; height <= chain.GetBestHeight(); height++ {
+		block := handler.ErrorHandler(chain.GetBlockByHeight(height))
+		// the genesis block spends nothing and has no undo record
+		undo, _ := chain.getBlockUndo(block.Hash)
+		handler.ErrorHandler(chain.Database.Update(func(txn *badger.Txn) error {
+			count += indexAddresses(txn, &block, undo)
+			return nil
+		}))
+	}
+	handler.ErrorHandler(chain.Database.Update(func(txn *badger.Txn) error {
+		return txn.Set(addrIndexKey, []byte{})
+	}))
+	chain.addrIndex = true
+	return count
+}
@@ -0,0 +1,47 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rodolfoviolla/go-blockchain/params"
+	"github.com/rodolfoviolla/go-blockchain/wallet"
+)
+
+func TestAddressHistoryFollowsUndoRecords(t *testing.T) {
+	chain := newTestChain(t, params.RegTest)
+	w1, w2 := wallet.MakeWallet(), wallet.MakeWallet()
+	mineBlocks(t, chain, w1, chain.Params.CoinbaseMaturity+1)
+	fork := tipBlock(t, chain)
+	unspentTxOutputsSet := UnspentTxOutputsSet{chain}
+	tx := NewTransaction(w1, string(w2.Address(chain.Params)), 5, 0, &unspentTxOutputsSet)
+	spending := makeBlock(t, chain, &fork, []*Transaction{coinbaseTo(chain, w2, fork.Height+1, 0), tx})
+	if err := chain.AddBlock(spending); err != nil {
+		t.Fatal(err)
+	}
+	chain.ReindexAddresses()
+	pubKeyHash := wallet.PublicKeyHash(w1.PublicKey)
+	_, total := chain.AddressHistory(pubKeyHash, 0, 0)
+	history, _ := chain.AddressHistory(pubKeyHash, total-2, 2)
+	spent := chain.BlockSubsidy(1)
+	var sent AddressTx
+	for _, entry := range history {
+		if entry.Sent {
+			sent = entry
+		}
+	}
+	if !bytes.Equal(sent.TxID, tx.ID) || sent.Height != spending.Height || sent.Amount != spent {
+		t.Fatalf("history ends with %+v, want %d sent by %x", history, spent, tx.ID)
+	}
+	side := makeBlock(t, chain, &fork, []*Transaction{coinbaseTo(chain, w2, fork.Height+1, 0)})
+	if err := chain.AddBlock(side); err != nil {
+		t.Fatal(err)
+	}
+	longer := makeBlock(t, chain, side, []*Transaction{coinbaseTo(chain, w2, side.Height+1, 0)})
+	if err := chain.AddBlock(longer); err != nil {
+		t.Fatal(err)
+	}
+	if _, after := chain.AddressHistory(pubKeyHash, 0, 0); after != total-2 {
+		t.Fatalf("%d entries after the reorg, want %d", after, total-2)
+	}
+}
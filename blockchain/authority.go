@@ -0,0 +1,65 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/rodolfoviolla/go-blockchain/wallet"
+)
+
+var (
+	ErrNotInTurn = errors.New("signer is not in turn for this height")
+	ErrBadSignature = errors.New("block signature is invalid")
+)
+
+// ProofOfAuthorityEngine lets a fixed set of signers take turns, the block at
+// height h being signed by Signers[h % len(Signers)].
+type ProofOfAuthorityEngine struct {
+	Signers [][]byte
+}
+
+func (poa *ProofOfAuthorityEngine) Signer(height int) []byte {
+	return poa.Signers[height%len(poa.Signers)]
+}
+
+func (poa *ProofOfAuthorityEngine) NextDifficulty(chain *BlockChain, parent *BlockHeader) int {
+	return chain.minimumDifficulty()
+}
+
+func (poa *ProofOfAuthorityEngine) Seal(ctx context.Context, chain *BlockChain, block *Block) error {
+	if chain.Signer == nil || !bytes.Equal(wallet.PublicKeyHash(chain.Signer.PublicKey), poa.Signer(block.Height)) {
+		return fmt.Errorf("%w: %d", ErrNotInTurn, block.Height)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	block.Signer = chain.Signer.PublicKey
+	block.Hash = block.BlockHeader.Hash()
+	r, s, err := ecdsa.Sign(rand.Reader, &chain.Signer.PrivateKey, block.Hash)
+	if err != nil {
+		return err
+	}
+	block.Signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	return nil
+}
+
+func (poa *ProofOfAuthorityEngine) VerifySeal(header *BlockHeader) error {
+	if header.Height < 0 {
+		return fmt.Errorf("%w: %d", ErrBadHeight, header.Height)
+	}
+	if !bytes.Equal(wallet.PublicKeyHash(header.Signer), poa.Signer(header.Height)) {
+		return fmt.Errorf("%w: %d", ErrNotInTurn, header.Height)
+	}
+	r, s := formatBytes(header.Signature)
+	x, y := formatBytes(header.Signer)
+	pubKey := ecdsa.PublicKey{Curve: elliptic.P256(), X: &x, Y: &y}
+	if !ecdsa.Verify(&pubKey, header.Hash(), &r, &s) {
+		return fmt.Errorf("%w: %x", ErrBadSignature, header.Hash())
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/rodolfoviolla/go-blockchain/params"
+	"github.com/rodolfoviolla/go-blockchain/wallet"
+)
+
+func continuePanic(nodeId string, chainParams *params.ChainParams) (message string) {
+	defer func() {
+		message = fmt.Sprint(recover())
+	}()
+	ContinueBlockChain(nodeId, chainParams).Database.Close()
+	return ""
+}
+
+func TestProofOfAuthority(t *testing.T) {
+	signer, other := wallet.MakeWallet(), wallet.MakeWallet()
+	chainParams := params.RegTest
+	chainParams.DataDir = t.TempDir()
+	chainParams.Signers = []string{string(signer.Address(&chainParams))}
+	chain := InitBlockChain("test", &chainParams)
+	unspentTxOutputsSet := UnspentTxOutputsSet{chain}
+	unspentTxOutputsSet.ReIndex()
+	chain.Signer = other
+	if _, err := chain.MineBlock(context.Background(), []*Transaction{coinbaseTo(chain, other, 1, 0)}); !errors.Is(err, ErrNotInTurn) {
+		t.Fatalf("got %v, want %v", err, ErrNotInTurn)
+	}
+	chain.Signer = signer
+	block, err := chain.MineBlock(context.Background(), []*Transaction{coinbaseTo(chain, signer, 1, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := block.BlockHeader
+	header.Height = -1
+	if err := chain.CheckBlockHeader(&header, header.Hash()); !errors.Is(err, ErrBadHeight) {
+		t.Fatalf("negative height: got %v, want %v", err, ErrBadHeight)
+	}
+	chain.Database.Close()
+
+	withoutSigners := chainParams
+	withoutSigners.Signers = nil
+	chain = ContinueBlockChain("test", &withoutSigners)
+	if _, ok := chain.Consensus.(*ProofOfAuthorityEngine); !ok || strings.Join(chain.Params.Signers, ",") != chainParams.Signers[0] {
+		t.Fatalf("reopened with %T and signers %v", chain.Consensus, chain.Params.Signers)
+	}
+	chain.Database.Close()
+
+	otherSigners := chainParams
+	otherSigners.Signers = []string{string(other.Address(&chainParams))}
+	if message := continuePanic("test", &otherSigners); !strings.Contains(message, "is signed by") {
+		t.Fatalf("got %q when reopening with other signers", message)
+	}
+}
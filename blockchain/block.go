@@ -2,52 +2,113 @@ package blockchain
 
 import (
 	"bytes"
-	"encoding/gob"
+	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/rodolfoviolla/go-blockchain/handler"
 )
 type Block struct {
-	Timestamp int64
+	BlockHeader
 	Hash []byte
 	Transactions []*Transaction
-	PrevHash []byte
-	Nonce int
-	Height int
 }
 
-func (b *Block) HashTransactions() []byte {
+func (b *Block) merkleTree() *MerkleTree {
 	var txHashes [][]byte
 	for _, tx := range b.Transactions {
 		txHashes = append(txHashes, tx.Serialize())
 	}
-	tree := NewMerkleTree(txHashes)
-	return tree.RootNode.Data
+	return NewMerkleTree(txHashes)
+}
+
+func (b *Block) HashTransactions() []byte {
+	return b.merkleTree().RootNode.Data
+}
+
+// MerkleProof returns the position of the transaction in the block and the
+// proof linking its serialization to the header merkle root.
+func (b *Block) MerkleProof(txID []byte) (int, []MerkleProofNode, error) {
+	for i, tx := range b.Transactions {
+		if bytes.Equal(tx.ID, txID) {
+			proof, err := b.merkleTree().Proof(i)
+			return i, proof, err
+		}
+	}
+	return 0, nil, fmt.Errorf("transaction %x is not in block %x", txID, b.Hash)
+}
+
+func NewBlock(txs []*Transaction, prevHash []byte, height, difficulty int) *Block {
+	header := BlockHeader{BlockVersion, prevHash, nil, time.Now().Unix(), difficulty, 0, height, nil, nil}
+	block := &Block{header, []byte{}, txs}
+	block.MerkleRoot = block.HashTransactions()
+	return block
 }
 
-func CreateBlock(txs []*Transaction, prevHash []byte, height int) *Block {
-	block := &Block{time.Now().Unix(),[]byte{}, txs, prevHash, 0, height}
-	pow := NewProof(block)
-	nonce, hash := pow.Run()
-	block.Hash = hash[:]
-	block.Nonce = nonce
+func CreateBlock(txs []*Transaction, prevHash []byte, height, difficulty int) *Block {
+	block := NewBlock(txs, prevHash, height, difficulty)
+	handler.ErrorHandler(block.Seal(context.Background(), time.Now, nil))
 	return block
 }
 
-func Genesis(coinbase *Transaction) *Block {
-	return CreateBlock([]*Transaction{coinbase}, []byte{}, 0)
+// Seal searches a nonce for the block, reading the current time from now when
+// the nonce space runs out.
+func (b *Block) Seal(ctx context.Context, now func() time.Time, onHashRate func(float64)) error {
+	for {
+		pow := NewProof(&b.BlockHeader)
+		pow.OnHashRate = onHashRate
+		nonce, hash, err := pow.Run(ctx)
+		if err == nil {
+			b.Hash = hash
+			b.Nonce = nonce
+			return nil
+		}
+		if !errors.Is(err, ErrNonceSpaceExhausted) {
+			return err
+		}
+		b.rollHeader(now())
+	}
+}
+
+// rollHeader gives the miner a fresh nonce space by moving the timestamp
+// forward and bumping the coinbase extra nonce, which changes the merkle root.
+func (b *Block) rollHeader(now time.Time) {
+	if timestamp := now.Unix(); timestamp > b.Timestamp {
+		b.Timestamp = timestamp
+	}
+	if coinbase := b.Transactions[0]; coinbase.IsCoinbase() {
+		coinbase.SetExtraNonce(coinbase.ExtraNonce() + 1)
+		b.MerkleRoot = b.HashTransactions()
+	}
 }
 
 func (b *Block) Serialize() []byte {
-	var res bytes.Buffer
-	encoder := gob.NewEncoder(&res)
-	handler.ErrorHandler(encoder.Encode((b)))
-	return res.Bytes()
+	encoder := NewEncoder()
+	encoder.writeHeader(&b.BlockHeader)
+	encoder.WriteBytes(b.Hash)
+	encoder.WriteCount(len(b.Transactions))
+	for _, tx := range b.Transactions {
+		encoder.writeTransaction(tx)
+	}
+	return encoder.Bytes()
 }
 
 func Deserialize(data []byte) *Block {
+	return handler.ErrorHandler(DecodeBlock(data))
+}
+
+// DecodeBlock is Deserialize for data that did not come from the local
+// database, returning the decoding error instead of panicking.
+func DecodeBlock(data []byte) (*Block, error) {
 	var block Block
-	decoder := gob.NewDecoder(bytes.NewReader(data))
-	handler.ErrorHandler(decoder.Decode(&block))
-	return &block
+	decoder := NewDecoder(data)
+	block.BlockHeader = decoder.readHeader()
+	block.Hash = decoder.ReadBytes()
+	count := decoder.ReadCount()
+	for i := 0; i < count && decoder.err == nil; i++ {
+		tx := decoder.readTransaction()
+		block.Transactions = append(block.Transactions, &tx)
+	}
+	return &block, decoder.Finish()
 }
\ No newline at end of file
@@ -2,28 +2,49 @@ package blockchain
 
 import (
 	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
+	"math/big"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/dgraph-io/badger/v3"
 	"github.com/rodolfoviolla/go-blockchain/handler"
+	"github.com/rodolfoviolla/go-blockchain/params"
+	"github.com/rodolfoviolla/go-blockchain/wallet"
 )
 
-const (
-	dbPath = "./tmp/blocks_%s"
-	genesisData = "First Transaction from Genesis"
+var (
+	networkKey = []byte("network")
+	signersKey = []byte("signers")
 )
 
 type BlockChain struct {
 	LastHash []byte
 	Database *badger.DB
+	Params *params.ChainParams
+	Consensus Consensus
+	Signer *wallet.Wallet
+	OnBlockConnected func(*Block)
+	OnBlockDisconnected func(*Block)
+	OnHashRate func(float64)
+	Now func() time.Time
+	mutex sync.Mutex
+	tipMutex sync.Mutex
+	tipChanged chan struct{}
+	assumeValidMutex sync.Mutex
+	assumeValid map[int]string
+	orphans orphanPool
+	txIndex bool
+	addrIndex bool
 }
 
 func DBExists(path string) bool {
@@ -33,8 +54,8 @@ func DBExists(path string) bool {
 	return true
 }
 
-func ContinueBlockChain(nodeId string) *BlockChain {
-	path := fmt.Sprintf(dbPath, nodeId)
+func ContinueBlockChain(nodeId string, chainParams *params.ChainParams) *BlockChain {
+	path := chainParams.BlocksPath(nodeId)
 	if !DBExists(path) {
 		fmt.Println("No existing blockchain found, create one!")
 		runtime.Goexit()
@@ -44,15 +65,41 @@ func ContinueBlockChain(nodeId string) *BlockChain {
 	opts.Logger = nil
 	db := handler.ErrorHandler(openDB(path, opts))
 	handler.ErrorHandler(db.Update(func(txn *badger.Txn) error {
-		item := handler.ErrorHandler(txn.Get([]byte("lh")))
+		item := handler.ErrorHandler(txn.Get(networkKey))
+		if network := handler.ErrorHandler(item.ValueCopy(nil)); string(network) != chainParams.Name {
+			return fmt.Errorf("blockchain at %s belongs to %s, not %s", path, network, chainParams.Name)
+		}
+		signers := ""
+		if item, err := txn.Get(signersKey); err == nil {
+			signers = string(handler.ErrorHandler(item.ValueCopy(nil)))
+		}
+		if len(chainParams.Signers) == 0 && signers != "" {
+			storedParams := *chainParams
+			storedParams.Signers = strings.Split(signers, ",")
+			chainParams = &storedParams
+		} else if strings.Join(chainParams.Signers, ",") != signers {
+			return fmt.Errorf("blockchain at %s is signed by %q, not %q", path, signers, strings.Join(chainParams.Signers, ","))
+		}
+		genesis := GenesisBlock(chainParams)
+		handler.ErrorHandler(checkGenesis(genesis, chainParams))
+		if _, err := txn.Get(genesis.Hash); err != nil {
+			return fmt.Errorf("blockchain at %s does not start with the %s genesis block", path, chainParams.Name)
+		}
+		item = handler.ErrorHandler(txn.Get([]byte("lh")))
 		lastHash = handler.ErrorHandler(item.ValueCopy(nil))
 		return nil
 	}))
-	return &BlockChain{lastHash, db}
+	consensus := handler.ErrorHandler(NewConsensus(chainParams))
+	chain := &BlockChain{LastHash: lastHash, Database: db, Params: chainParams, Consensus: consensus, txIndex: txIndexEnabled(db), addrIndex: addrIndexEnabled(db)}
+	if _, err := chain.GetBlockHashByHeight(chain.GetBestHeight()); err != nil {
+		chain.reindexHeights()
+	}
+	chain.activateBestChain()
+	return chain
 }
 
-func InitBlockChain(address, nodeId string) *BlockChain {
-	path := fmt.Sprintf(dbPath, nodeId)
+func InitBlockChain(nodeId string, chainParams *params.ChainParams) *BlockChain {
+	path := chainParams.BlocksPath(nodeId)
 	if DBExists(path) {
 		fmt.Println("Blockchain already exists")
 		runtime.Goexit()
@@ -62,35 +109,89 @@ func InitBlockChain(address, nodeId string) *BlockChain {
 	opts.Logger = nil
 	db := handler.ErrorHandler(openDB(path, opts))
 	handler.ErrorHandler(db.Update(func(txn *badger.Txn) error {
-		coinbaseTx := CoinbaseTx(address, genesisData)
-		genesis := Genesis(coinbaseTx)
+		genesis := GenesisBlock(chainParams)
+		handler.ErrorHandler(checkGenesis(genesis, chainParams))
+		handler.ErrorHandler(txn.Set(networkKey, []byte(chainParams.Name)))
+		if len(chainParams.Signers) > 0 {
+			handler.ErrorHandler(txn.Set(signersKey, []byte(strings.Join(chainParams.Signers, ","))))
+		}
 		fmt.Println("Genesis created")
 		handler.ErrorHandler(txn.Set(genesis.Hash, genesis.Serialize()))
+		handler.ErrorHandler(txn.Set(append(headerPrefix, genesis.Hash...), genesis.BlockHeader.Serialize()))
+		handler.ErrorHandler(txn.Set(append(chainWorkPrefix, genesis.Hash...), blockWork(genesis.Difficulty).Bytes()))
+		handler.ErrorHandler(txn.Set(append(chainTipsPrefix, genesis.Hash...), []byte{}))
+		handler.ErrorHandler(txn.Set(heightKey(0), genesis.Hash))
 		err := txn.Set([]byte("lh"), genesis.Hash)
 		lastHash = genesis.Hash
 		return err
 	}))
-	return &BlockChain{lastHash, db}
+	consensus := handler.ErrorHandler(NewConsensus(chainParams))
+	return &BlockChain{LastHash: lastHash, Database: db, Params: chainParams, Consensus: consensus}
 }
 
-func (chain *BlockChain) AddBlock(block *Block) {
-	handler.ErrorHandler(chain.Database.Update(func(txn *badger.Txn) error {
-		if _, err := txn.Get(block.Hash); err == nil {
-			return nil
+// AddBlock stores the block and connects it, and then the orphans waiting for
+// it, if that makes a chain with more work. Blocks are added one at a time.
+func (chain *BlockChain) AddBlock(block *Block) error {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	return chain.acceptBlock(block)
+}
+
+func (chain *BlockChain) acceptBlock(block *Block) error {
+	if err := chain.addBlock(block); err != nil {
+		return err
+	}
+	chain.connectOrphans(block.Hash)
+	return nil
+}
+
+func (chain *BlockChain) addBlock(block *Block) error {
+	if _, err := chain.GetBlock(block.Hash); err == nil {
+		return nil
+	}
+	if _, err := chain.GetChainWork(block.PrevHash); err != nil {
+		if err := chain.CheckBlock(block); err != nil {
+			return err
 		}
-		blockData := block.Serialize()
-		handler.ErrorHandler(txn.Set(block.Hash, blockData))
-		item := handler.ErrorHandler(txn.Get([]byte("lh")))
-		lastHash, _ := item.ValueCopy(nil)
-		item = handler.ErrorHandler(txn.Get(lastHash))
-		lastBlockData, _ := item.ValueCopy(nil)
-		lastBlock := Deserialize(lastBlockData)
-		if block.Height > lastBlock.Height {
-			handler.ErrorHandler(txn.Set([]byte("lh"), block.Hash))
-			chain.LastHash = block.Hash
+		chain.addOrphan(block)
+		return fmt.Errorf("%w: %x", ErrUnknownParent, block.PrevHash)
+	}
+	if err := chain.ValidateBlock(block); err != nil {
+		return err
+	}
+	if !chain.storeBlock(block) {
+		return nil
+	}
+	if bytes.Equal(block.PrevHash, chain.LastHash) {
+		if err := chain.connectBlock(block); err != nil {
+			chain.removeBlocks([]*Block{block})
+			chain.restoreChainTip(block.PrevHash)
+			return err
 		}
 		return nil
+	}
+	return chain.reorganize(block)
+}
+
+// storeBlock saves a validated block with its header, chain work and chain tip
+// and reports whether it has more work than the current tip.
+func (chain *BlockChain) storeBlock(block *Block) bool {
+	isBestChain := false
+	handler.ErrorHandler(chain.Database.Update(func(txn *badger.Txn) error {
+		handler.ErrorHandler(txn.Set(block.Hash, block.Serialize()))
+		handler.ErrorHandler(txn.Set(append(headerPrefix, block.Hash...), block.BlockHeader.Serialize()))
+		parentWork := handler.ErrorHandler(getChainWork(txn, block.PrevHash))
+		work := new(big.Int).Add(parentWork, blockWork(block.Difficulty))
+		handler.ErrorHandler(txn.Set(append(chainWorkPrefix, block.Hash...), work.Bytes()))
+		handler.ErrorHandler(txn.Delete(append(chainTipsPrefix, block.PrevHash...)))
+		handler.ErrorHandler(txn.Set(append(chainTipsPrefix, block.Hash...), []byte{}))
+		item := handler.ErrorHandler(txn.Get([]byte("lh")))
+		lastHash := handler.ErrorHandler(item.ValueCopy(nil))
+		bestWork := handler.ErrorHandler(getChainWork(txn, lastHash))
+		isBestChain = work.Cmp(bestWork) > 0
+		return nil
 	}))
+	return isBestChain
 }
 
 func (chain *BlockChain) GetBlock(blockHash []byte) (Block, error) {
@@ -109,54 +210,88 @@ func (chain *BlockChain) GetBlock(blockHash []byte) (Block, error) {
 
 func (chain *BlockChain) GetBlockHashes() [][]byte {
 	var blocks [][]byte
-	iterator := chain.Iterator()
-	for {
-		block := iterator.Next()
-		blocks = append(blocks, block.Hash)
-		if len (block.PrevHash) == 0 {
-			break
-		}
-	}
-	return blocks
-}
-
-func (chain *BlockChain) GetBestHeight() int {
-	var lastBlock Block
 	handler.ErrorHandler(chain.Database.View(func(txn *badger.Txn) error {
 		item := handler.ErrorHandler(txn.Get([]byte("lh")))
-		lastHash, _ := item.ValueCopy(nil)
-		item = handler.ErrorHandler(txn.Get(lastHash))
-		lastBlockData, _ := item.ValueCopy(nil)
-		lastBlock = *Deserialize(lastBlockData)
+		lastHash := handler.ErrorHandler(item.ValueCopy(nil))
+		item = handler.ErrorHandler(txn.Get(append(headerPrefix, lastHash...)))
+		tip := DeserializeHeader(handler.ErrorHandler(item.ValueCopy(nil)))
+		for height := tip.Height; height >= 0; height-- {
+			item = handler.ErrorHandler(txn.Get(heightKey(height)))
+			blocks = append(blocks, handler.ErrorHandler(item.ValueCopy(nil)))
+		}
 		return nil
 	}))
-	return lastBlock.Height
+	return blocks
 }
 
-func (chain *BlockChain) MineBlock(transaction []*Transaction) *Block {
+// tipHeader returns the hash and the header of the stored chain tip, without
+// loading its block.
+func (chain *BlockChain) tipHeader() ([]byte, BlockHeader) {
 	var lastHash []byte
-	var lastHeight int
+	var header *BlockHeader
 	handler.ErrorHandler(chain.Database.View(func(txn *badger.Txn) error {
 		item := handler.ErrorHandler(txn.Get([]byte("lh")))
 		lastHash = handler.ErrorHandler(item.ValueCopy(nil))
-		item = handler.ErrorHandler(txn.Get(lastHash))
-		lastBlockData, _ := item.ValueCopy(nil)
-		lastBlock := Deserialize(lastBlockData)
-		lastHeight = lastBlock.Height
+		item = handler.ErrorHandler(txn.Get(append(headerPrefix, lastHash...)))
+		header = DeserializeHeader(handler.ErrorHandler(item.ValueCopy(nil)))
 		return nil
 	}))
-	newBlock := CreateBlock(transaction, lastHash, lastHeight+1)
-	handler.ErrorHandler(chain.Database.Update(func(txn *badger.Txn) error {
-		handler.ErrorHandler(txn.Set(newBlock.Hash, newBlock.Serialize()))
-		err := txn.Set([]byte("lh"), newBlock.Hash)
-		chain.LastHash = newBlock.Hash
-		return err
-	}))
-	return newBlock
+	return lastHash, *header
+}
+
+func (chain *BlockChain) GetBestHeight() int {
+	_, header := chain.tipHeader()
+	return header.Height
+}
+
+func (chain *BlockChain) MineBlock(ctx context.Context, transactions []*Transaction) (*Block, error) {
+	tipChanged := chain.TipChanged()
+	lastHash, lastHeader := chain.tipHeader()
+	if len(transactions) == 0 || !transactions[0].IsCoinbase() {
+		return nil, ErrBadCoinbase
+	}
+	if err := chain.ValidateTransactions(transactions, lastHeader.Height+1); err != nil {
+		return nil, err
+	}
+	difficulty := chain.NextDifficulty(&lastHeader)
+	newBlock := NewBlock(transactions, lastHash, lastHeader.Height+1, difficulty)
+	if size := newBlock.Size(); size > MaxBlockSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrBlockTooLarge, size)
+	}
+	if sigOps := newBlock.SigOpCount(); sigOps > MaxBlockSigOps {
+		return nil, fmt.Errorf("%w: %d", ErrTooManySigOps, sigOps)
+	}
+	newBlock.Timestamp = chain.now().Unix()
+	if medianTime := chain.MedianTimePast(&lastHeader); newBlock.Timestamp <= medianTime {
+		newBlock.Timestamp = medianTime + 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-tipChanged:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	if err := chain.Consensus.Seal(ctx, chain, newBlock); err != nil {
+		select {
+		case <-tipChanged:
+			return nil, ErrStaleTip
+		default:
+			return nil, err
+		}
+	}
+	if err := chain.AddBlock(newBlock); err != nil {
+		return nil, err
+	}
+	return newBlock, nil
 }
 
-func (chain *BlockChain) FindUnspentTransactionOutputs() map[string]TxOutputs {
-	unspentTxOutputs := make(map[string]TxOutputs)
+// FindUnspentTransactionOutputs walks the main chain and returns its unspent
+// outputs, keyed by transaction id and then by output index.
+func (chain *BlockChain) FindUnspentTransactionOutputs() map[string]map[int]UnspentOutput {
+	unspentTxOutputs := make(map[string]map[int]UnspentOutput)
 	spentTXOs := make(map[string][]int)
 	iterator := chain.Iterator()
 	for {
@@ -171,9 +306,10 @@ func (chain *BlockChain) FindUnspentTransactionOutputs() map[string]TxOutputs {
 						}
 					}
 				}
-				outs := unspentTxOutputs[txID]
-				outs.Outputs = append(outs.Outputs, out)
-				unspentTxOutputs[txID] = outs
+				if unspentTxOutputs[txID] == nil {
+					unspentTxOutputs[txID] = make(map[int]UnspentOutput)
+				}
+				unspentTxOutputs[txID][outIdx] = UnspentOutput{out, block.Height, tx.IsCoinbase()}
 			}
 			if !tx.IsCoinbase() {
 				for _, in := range tx.Inputs {
@@ -189,7 +325,37 @@ func (chain *BlockChain) FindUnspentTransactionOutputs() map[string]TxOutputs {
 	return unspentTxOutputs
 }
 
+func (bc *BlockChain) FindTransactionBlock(ID []byte) (Block, error) {
+	if bc.txIndex {
+		block, _, err := bc.findIndexedTransaction(ID)
+		if err != nil {
+			return Block{}, errors.New("Transaction does not exist")
+		}
+		return block, nil
+	}
+	iterator := bc.Iterator()
+	for {
+		block := iterator.Next()
+		for _, tx := range block.Transactions {
+			if bytes.Equal(tx.ID, ID) {
+				return *block, nil
+			}
+		}
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+	return Block{}, errors.New("Transaction does not exist")
+}
+
 func (bc *BlockChain) FindTransaction(ID []byte) (Transaction, error) {
+	if bc.txIndex {
+		block, position, err := bc.findIndexedTransaction(ID)
+		if err != nil {
+			return Transaction{}, errors.New("Transaction does not exist")
+		}
+		return *block.Transactions[position], nil
+	}
 	iterator := bc.Iterator()
 	for {
 		block := iterator.Next()
@@ -0,0 +1,75 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/rodolfoviolla/go-blockchain/handler"
+)
+
+var (
+	ErrCheckpointMismatch = errors.New("block does not match the checkpoint at its height")
+	ErrForkBeforeCheckpoint = errors.New("block forks the chain below the last checkpoint")
+)
+
+// lastCheckpoint is the highest checkpoint the main chain has reached.
+func (chain *BlockChain) lastCheckpoint() int {
+	_, tip := chain.tipHeader()
+	last := -1
+	for height := range chain.Params.Checkpoints {
+		if height <= tip.Height && height > last {
+			last = height
+		}
+	}
+	return last
+}
+
+func (chain *BlockChain) checkCheckpoints(header *BlockHeader, hash []byte) error {
+	if checkpoint, ok := chain.Params.Checkpoints[header.Height]; ok && checkpoint != hex.EncodeToString(hash) {
+		return fmt.Errorf("%w: %x at height %d", ErrCheckpointMismatch, hash, header.Height)
+	}
+	if last := chain.lastCheckpoint(); header.Height < last {
+		return fmt.Errorf("%w: height %d is below %d", ErrForkBeforeCheckpoint, header.Height, last)
+	}
+	return nil
+}
+
+// AddHeader stores a validated header ahead of its block so that ancestors of
+// the assumed valid block can be recognised while they are downloaded.
+func (chain *BlockChain) AddHeader(header *BlockHeader, hash []byte) error {
+	if _, err := chain.GetBlockHeader(hash); err == nil {
+		return nil
+	}
+	if err := chain.ValidateHeader(header, hash); err != nil {
+		return err
+	}
+	return chain.Database.Update(func(txn *badger.Txn) error {
+		return txn.Set(append(headerPrefix, hash...), header.Serialize())
+	})
+}
+
+// isAssumedValid reports whether the block is an ancestor of the assumed valid
+// block, whose transaction signatures do not need to be checked again.
+func (chain *BlockChain) isAssumedValid(block *Block) bool {
+	if chain.Params.AssumeValid == "" {
+		return false
+	}
+	chain.assumeValidMutex.Lock()
+	defer chain.assumeValidMutex.Unlock()
+	if chain.assumeValid == nil {
+		hash := handler.ErrorHandler(hex.DecodeString(chain.Params.AssumeValid))
+		header, err := chain.GetBlockHeader(hash)
+		if err != nil {
+			return false
+		}
+		chain.assumeValid = map[int]string{header.Height: chain.Params.AssumeValid}
+		for len(header.PrevHash) > 0 {
+			hash = header.PrevHash
+			header = handler.ErrorHandler(chain.GetBlockHeader(hash))
+			chain.assumeValid[header.Height] = hex.EncodeToString(hash)
+		}
+	}
+	return chain.assumeValid[block.Height] == hex.EncodeToString(block.Hash)
+}
@@ -0,0 +1,76 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/rodolfoviolla/go-blockchain/params"
+	"github.com/rodolfoviolla/go-blockchain/wallet"
+)
+
+// checkpointParams returns regtest params with a checkpoint map of their own,
+// so that tests can add checkpoints without touching params.RegTest.
+func checkpointParams() params.ChainParams {
+	chainParams := params.RegTest
+	chainParams.Checkpoints = map[int]string{}
+	for height, hash := range params.RegTest.Checkpoints {
+		chainParams.Checkpoints[height] = hash
+	}
+	return chainParams
+}
+
+func TestCheckpointMismatch(t *testing.T) {
+	chainParams := checkpointParams()
+	chainParams.Checkpoints[1] = hex.EncodeToString(make([]byte, 32))
+	chain := newTestChain(t, chainParams)
+	genesis := tipBlock(t, chain)
+	block := makeBlock(t, chain, &genesis, []*Transaction{coinbaseTo(chain, wallet.MakeWallet(), 1, 0)})
+	if err := chain.AddBlock(block); !errors.Is(err, ErrCheckpointMismatch) {
+		t.Fatalf("got %v, want %v", err, ErrCheckpointMismatch)
+	}
+	if err := chain.AddHeader(&block.BlockHeader, block.Hash); !errors.Is(err, ErrCheckpointMismatch) {
+		t.Fatalf("header: got %v, want %v", err, ErrCheckpointMismatch)
+	}
+}
+
+func TestForkBeforeCheckpoint(t *testing.T) {
+	chain := newTestChain(t, checkpointParams())
+	w := wallet.MakeWallet()
+	genesis := tipBlock(t, chain)
+	mineBlocks(t, chain, w, 2)
+	chain.Params.Checkpoints[2] = hex.EncodeToString(chain.LastHash)
+	fork := makeBlock(t, chain, &genesis, []*Transaction{coinbaseTo(chain, w, 1, 0)})
+	if err := chain.AddBlock(fork); !errors.Is(err, ErrForkBeforeCheckpoint) {
+		t.Fatalf("got %v, want %v", err, ErrForkBeforeCheckpoint)
+	}
+	tip := tipBlock(t, chain)
+	if err := chain.AddBlock(makeBlock(t, chain, &tip, []*Transaction{coinbaseTo(chain, w, 3, 0)})); err != nil {
+		t.Fatalf("block above the checkpoint: %s", err)
+	}
+}
+
+func TestAssumeValidSkipsSignatures(t *testing.T) {
+	chain := newTestChain(t, checkpointParams())
+	w1, w2 := wallet.MakeWallet(), wallet.MakeWallet()
+	mineBlocks(t, chain, w1, chain.Params.CoinbaseMaturity+1)
+	tip := tipBlock(t, chain)
+	unspentTxOutputsSet := UnspentTxOutputsSet{chain}
+	tx := NewTransaction(w1, string(w2.Address(chain.Params)), 5, 0, &unspentTxOutputsSet)
+	tx.Inputs[0].Signature[0] ^= 0xff
+	block := makeBlock(t, chain, &tip, []*Transaction{coinbaseTo(chain, w1, tip.Height+1, 0), tx})
+	if err := chain.AddBlock(block); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidSignature)
+	}
+	chain.Params.AssumeValid = hex.EncodeToString(block.Hash)
+	if err := chain.AddHeader(&block.BlockHeader, block.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.AddBlock(block); err != nil {
+		t.Fatalf("assumed valid block: %s", err)
+	}
+	other := makeBlock(t, chain, block, []*Transaction{coinbaseTo(chain, w1, block.Height+1, 0)})
+	if chain.isAssumedValid(other) {
+		t.Fatal("a block after the assumed valid one skips signature checks")
+	}
+}
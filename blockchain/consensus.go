@@ -0,0 +1,49 @@
+package blockchain
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rodolfoviolla/go-blockchain/params"
+	"github.com/rodolfoviolla/go-blockchain/wallet"
+)
+
+// Consensus decides who may extend the chain: it picks the difficulty a block
+// built on parent must carry, seals new blocks and checks the seal of received
+// headers.
+type Consensus interface {
+	NextDifficulty(chain *BlockChain, parent *BlockHeader) int
+	Seal(ctx context.Context, chain *BlockChain, block *Block) error
+	VerifySeal(header *BlockHeader) error
+}
+
+func NewConsensus(chainParams *params.ChainParams) (Consensus, error) {
+	if len(chainParams.Signers) == 0 {
+		return ProofOfWorkEngine{}, nil
+	}
+	var signers [][]byte
+	for _, address := range chainParams.Signers {
+		if !wallet.ValidateAddress(address, chainParams) {
+			return nil, fmt.Errorf("signer address %q is not valid", address)
+		}
+		pubKeyHash := wallet.Base58Decode([]byte(address))
+		signers = append(signers, pubKeyHash[1:len(pubKeyHash)-4])
+	}
+	return &ProofOfAuthorityEngine{signers}, nil
+}
+
+type ProofOfWorkEngine struct{}
+
+func (ProofOfWorkEngine) Seal(ctx context.Context, chain *BlockChain, block *Block) error {
+	return block.Seal(ctx, chain.now, chain.OnHashRate)
+}
+
+func (ProofOfWorkEngine) VerifySeal(header *BlockHeader) error {
+	if header.Difficulty < MinDifficulty || header.Difficulty > MaxDifficulty {
+		return fmt.Errorf("%w: %d", ErrDifficultyOutOfRange, header.Difficulty)
+	}
+	if !NewProof(header).Validate() {
+		return fmt.Errorf("%w: %x", ErrBadProofOfWork, header.Hash())
+	}
+	return nil
+}
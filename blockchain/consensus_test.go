@@ -0,0 +1,22 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rodolfoviolla/go-blockchain/params"
+	"github.com/rodolfoviolla/go-blockchain/wallet"
+)
+
+func TestProofOfWorkRejectsDifficultyOutOfRange(t *testing.T) {
+	chain := newTestChain(t, params.RegTest)
+	genesis := tipBlock(t, chain)
+	block := makeBlock(t, chain, &genesis, []*Transaction{coinbaseTo(chain, wallet.MakeWallet(), 1, 0)})
+	for _, difficulty := range []int{-5, 0, MaxDifficulty + 1, 300} {
+		header := block.BlockHeader
+		header.Difficulty = difficulty
+		if err := chain.CheckBlockHeader(&header, header.Hash()); !errors.Is(err, ErrDifficultyOutOfRange) {
+			t.Errorf("difficulty %d: got %v, want %v", difficulty, err, ErrDifficultyOutOfRange)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package blockchain
+
+import "github.com/rodolfoviolla/go-blockchain/handler"
+
+const maxDifficultyAdjustment = 2
+
+// Every RetargetInterval blocks the difficulty moves one bit per doubling of
+// the actual window timespan against the expected one.
+func (chain *BlockChain) NextDifficulty(lastBlock *BlockHeader) int {
+	return chain.Consensus.NextDifficulty(chain, lastBlock)
+}
+
+func (ProofOfWorkEngine) NextDifficulty(chain *BlockChain, lastBlock *BlockHeader) int {
+	difficulty := lastBlock.Difficulty
+	interval := chain.Params.RetargetInterval
+	if !chain.Params.NoRetargeting && (lastBlock.Height+1)%interval == 0 {
+		first := lastBlock
+		for i := 0; i < interval-1 && len(first.PrevHash) > 0; i++ {
+			header := handler.ErrorHandler(chain.GetBlockHeader(first.PrevHash))
+			first = &header
+		}
+		actual := lastBlock.Timestamp - first.Timestamp
+		expected := int64(chain.Params.TargetBlockTime * (lastBlock.Height - first.Height))
+		difficulty = retarget(lastBlock.Difficulty, actual, expected)
+	}
+	if difficulty < chain.minimumDifficulty() {
+		return chain.minimumDifficulty()
+	}
+	return difficulty
+}
+
+// minimumDifficulty is the lowest difficulty the network accepts, so that
+// blocks with no work behind them are turned away before they are stored.
+func (chain *BlockChain) minimumDifficulty() int {
+	if chain.Params.MinDifficulty > MinDifficulty {
+		return chain.Params.MinDifficulty
+	}
+	return MinDifficulty
+}
+
+func retarget(difficulty int, actual, expected int64) int {
+	if actual < 1 {
+		actual = 1
+	}
+	delta := 0
+	for delta < maxDifficultyAdjustment && expected >= actual<<(delta+1) {
+		delta++
+	}
+	for delta <= 0 && delta > -maxDifficultyAdjustment && actual >= expected<<(-delta+1) {
+		delta--
+	}
+	difficulty += delta
+	if difficulty < MinDifficulty {
+		return MinDifficulty
+	}
+	if difficulty > MaxDifficulty {
+		return MaxDifficulty
+	}
+	return difficulty
+}
@@ -0,0 +1,231 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// EncodingVersion is the first byte of every serialized block, header,
+// transaction, unspent output entry and undo record. The format is described
+// in docs/serialization.md.
+const EncodingVersion = 1
+
+var (
+	ErrEncodingVersion = errors.New("unsupported encoding version")
+	ErrMalformedData = errors.New("malformed serialized data")
+)
+
+// Encoder writes a top-level value, starting with the version byte, out of the
+// primitives of the format. Network messages are written with it too.
+type Encoder struct {
+	buffer bytes.Buffer
+}
+
+func NewEncoder() *Encoder {
+	e := &Encoder{}
+	e.buffer.WriteByte(EncodingVersion)
+	return e
+}
+
+func (e *Encoder) Bytes() []byte {
+	return e.buffer.Bytes()
+}
+
+func (e *Encoder) WriteInt(value int) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(int64(value)))
+	e.buffer.Write(buf[:])
+}
+
+func (e *Encoder) WriteCount(count int) {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], uint32(count))
+	e.buffer.Write(buf[:])
+}
+
+func (e *Encoder) WriteBool(value bool) {
+	if value {
+		e.buffer.WriteByte(1)
+	} else {
+		e.buffer.WriteByte(0)
+	}
+}
+
+func (e *Encoder) WriteBytes(data []byte) {
+	e.WriteCount(len(data))
+	e.buffer.Write(data)
+}
+
+// Decoder reads the primitives of a top-level value. After the first error
+// every read returns a zero value, and the error is reported by Err and Finish.
+type Decoder struct {
+	data []byte
+	err error
+}
+
+func NewDecoder(data []byte) *Decoder {
+	d := &Decoder{data: data}
+	if version := d.read(1); d.err == nil && version[0] != EncodingVersion {
+		d.err = fmt.Errorf("%w: %d", ErrEncodingVersion, version[0])
+	}
+	return d
+}
+
+// Finish reports the first decoding error, or trailing bytes left over after
+// the value was read.
+func (d *Decoder) Finish() error {
+	if d.err == nil && len(d.data) > 0 {
+		d.err = fmt.Errorf("%w: %d trailing bytes", ErrMalformedData, len(d.data))
+	}
+	return d.err
+}
+
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+func (d *Decoder) read(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.data) {
+		d.err = fmt.Errorf("%w: need %d bytes, have %d", ErrMalformedData, n, len(d.data))
+		return nil
+	}
+	data := d.data[:n]
+	d.data = d.data[n:]
+	return data
+}
+
+func (d *Decoder) ReadInt() int {
+	if data := d.read(8); d.err == nil {
+		return int(int64(binary.BigEndian.Uint64(data)))
+	}
+	return 0
+}
+
+// ReadCount reads a length or list size, which can never exceed the bytes
+// left since every element takes at least one byte.
+func (d *Decoder) ReadCount() int {
+	data := d.read(4)
+	if d.err != nil {
+		return 0
+	}
+	count := binary.BigEndian.Uint32(data)
+	if uint64(count) > uint64(len(d.data)) {
+		d.err = fmt.Errorf("%w: count %d exceeds %d remaining bytes", ErrMalformedData, count, len(d.data))
+		return 0
+	}
+	return int(count)
+}
+
+func (d *Decoder) ReadBool() bool {
+	data := d.read(1)
+	if d.err != nil {
+		return false
+	}
+	if data[0] > 1 {
+		d.err = fmt.Errorf("%w: boolean %d", ErrMalformedData, data[0])
+	}
+	return data[0] == 1
+}
+
+func (d *Decoder) ReadBytes() []byte {
+	length := d.ReadCount()
+	if data := d.read(length); d.err == nil && length > 0 {
+		return append([]byte{}, data...)
+	}
+	return nil
+}
+
+func (e *Encoder) writeHeader(h *BlockHeader) {
+	e.WriteInt(h.Version)
+	e.WriteBytes(h.PrevHash)
+	e.WriteBytes(h.MerkleRoot)
+	e.WriteInt(int(h.Timestamp))
+	e.WriteInt(h.Difficulty)
+	e.WriteInt(h.Nonce)
+	e.WriteInt(h.Height)
+	e.WriteBytes(h.Signer)
+	e.WriteBytes(h.Signature)
+}
+
+func (d *Decoder) readHeader() BlockHeader {
+	var h BlockHeader
+	h.Version = d.ReadInt()
+	h.PrevHash = d.ReadBytes()
+	h.MerkleRoot = d.ReadBytes()
+	h.Timestamp = int64(d.ReadInt())
+	h.Difficulty = d.ReadInt()
+	h.Nonce = d.ReadInt()
+	h.Height = d.ReadInt()
+	h.Signer = d.ReadBytes()
+	h.Signature = d.ReadBytes()
+	return h
+}
+
+func (e *Encoder) writeTransaction(tx *Transaction) {
+	e.WriteBytes(tx.ID)
+	e.WriteCount(len(tx.Inputs))
+	for _, in := range tx.Inputs {
+		e.WriteBytes(in.ID)
+		e.WriteInt(in.Out)
+		e.WriteBytes(in.Signature)
+		e.WriteBytes(in.PubKey)
+	}
+	e.writeOutputs(tx.Outputs)
+}
+
+func (d *Decoder) readTransaction() Transaction {
+	var tx Transaction
+	tx.ID = d.ReadBytes()
+	count := d.ReadCount()
+	for i := 0; i < count && d.err == nil; i++ {
+		var in TxInput
+		in.ID = d.ReadBytes()
+		in.Out = d.ReadInt()
+		in.Signature = d.ReadBytes()
+		in.PubKey = d.ReadBytes()
+		tx.Inputs = append(tx.Inputs, in)
+	}
+	tx.Outputs = d.readOutputs()
+	return tx
+}
+
+func (e *Encoder) writeOutputs(outputs []TxOutput) {
+	e.WriteCount(len(outputs))
+	for _, out := range outputs {
+		e.WriteInt(out.Value)
+		e.WriteBytes(out.PubKeyHash)
+	}
+}
+
+func (d *Decoder) readOutputs() []TxOutput {
+	var outputs []TxOutput
+	count := d.ReadCount()
+	for i := 0; i < count && d.err == nil; i++ {
+		var out TxOutput
+		out.Value = d.ReadInt()
+		out.PubKeyHash = d.ReadBytes()
+		outputs = append(outputs, out)
+	}
+	return outputs
+}
+
+func (e *Encoder) writeUnspentOutput(entry *UnspentOutput) {
+	e.WriteInt(entry.Value)
+	e.WriteBytes(entry.PubKeyHash)
+	e.WriteInt(entry.Height)
+	e.WriteBool(entry.Coinbase)
+}
+
+func (d *Decoder) readUnspentOutput() UnspentOutput {
+	var entry UnspentOutput
+	entry.Value = d.ReadInt()
+	entry.PubKeyHash = d.ReadBytes()
+	entry.Height = d.ReadInt()
+	entry.Coinbase = d.ReadBool()
+	return entry
+}
@@ -0,0 +1,122 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/rodolfoviolla/go-blockchain/params"
+)
+
+// The vectors below are the examples in docs/serialization.md.
+const (
+	coinbaseVector = "0100000020296ccc3a0c4ab083f265e33f46cf16e5498b0fa923b9925cfedec2e5fe70bfaf0000000100000000ffffffffffffffff000000000000002e00000000000000004669727374205472616e73616374696f6e2066726f6d20526567746573742047656e65736973000000010000000000000014000000140000000000000000000000000000000000000000"
+	coinbaseIDVector = "296ccc3a0c4ab083f265e33f46cf16e5498b0fa923b9925cfedec2e5fe70bfaf"
+	headerVector = "0100000000000000010000000000000020be1e5a2406927d0ed66dda2962cc90ac4f8ca9def13714598eb65b418aec573400000000646419000000000000000001000000000000000500000000000000000000000000000000"
+	blockVector = "0100000000000000010000000000000020be1e5a2406927d0ed66dda2962cc90ac4f8ca9def13714598eb65b418aec5734000000006464190000000000000000010000000000000005000000000000000000000000000000000000002040d9d75803115743449cc77c9bcba22df997e8c2a206be621fdf91e41cbaeac40000000100000020296ccc3a0c4ab083f265e33f46cf16e5498b0fa923b9925cfedec2e5fe70bfaf0000000100000000ffffffffffffffff000000000000002e00000000000000004669727374205472616e73616374696f6e2066726f6d20526567746573742047656e65736973000000010000000000000014000000140000000000000000000000000000000000000000"
+	blockHashVector = "40d9d75803115743449cc77c9bcba22df997e8c2a206be621fdf91e41cbaeac4"
+	spendVector = "01000000208d1a3b7f9bfdcb8efdd4567b848813acc0122f91213c2ee29404fa77aa9548880000000100000020296ccc3a0c4ab083f265e33f46cf16e5498b0fa923b9925cfedec2e5fe70bfaf000000000000000000000002aabb00000001cc000000020000000000000007000000020102000000000000000d0000000103"
+	spendIDVector = "8d1a3b7f9bfdcb8efdd4567b848813acc0122f91213c2ee29404fa77aa954888"
+	unspentOutputVector = "010000000000000014000000140000000000000000000000000000000000000000000000000000000001"
+	undoVector = "010000000100000020296ccc3a0c4ab083f265e33f46cf16e5498b0fa923b9925cfedec2e5fe70bfaf00000000000000000000000000000014000000140000000000000000000000000000000000000000000000000000000001"
+)
+
+func decodeVector(t *testing.T, vector string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(vector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func checkRoundTrip(t *testing.T, name string, data, serialized []byte) {
+	t.Helper()
+	if !bytes.Equal(serialized, data) {
+		t.Errorf("%s re-serializes to %x, want %x", name, serialized, data)
+	}
+}
+
+func TestTransactionVectors(t *testing.T) {
+	tests := []struct {
+		name, vector, id string
+	}{
+		{"coinbase", coinbaseVector, coinbaseIDVector},
+		{"spend", spendVector, spendIDVector},
+	}
+	for _, test := range tests {
+		data := decodeVector(t, test.vector)
+		tx := DeserializeTransaction(data)
+		checkRoundTrip(t, test.name, data, tx.Serialize())
+		if id := hex.EncodeToString(tx.ID); id != test.id {
+			t.Errorf("%s id %s, want %s", test.name, id, test.id)
+		}
+		if !tx.HasValidID() {
+			t.Errorf("%s id does not match its contents", test.name)
+		}
+		if id := hex.EncodeToString(tx.Hash()); id != test.id {
+			t.Errorf("%s hashes to %s, want %s", test.name, id, test.id)
+		}
+	}
+}
+
+func TestHeaderVector(t *testing.T) {
+	data := decodeVector(t, headerVector)
+	header := DeserializeHeader(data)
+	checkRoundTrip(t, "header", data, header.Serialize())
+	genesis := GenesisBlock(&params.RegTest)
+	checkRoundTrip(t, "regtest genesis header", data, genesis.BlockHeader.Serialize())
+}
+
+func TestBlockVector(t *testing.T) {
+	data := decodeVector(t, blockVector)
+	block := Deserialize(data)
+	checkRoundTrip(t, "block", data, block.Serialize())
+	if hash := hex.EncodeToString(block.BlockHeader.Hash()); hash != blockHashVector {
+		t.Errorf("block hash %s, want %s", hash, blockHashVector)
+	}
+	checkRoundTrip(t, "regtest genesis", data, GenesisBlock(&params.RegTest).Serialize())
+}
+
+func TestUnspentOutputVector(t *testing.T) {
+	data := decodeVector(t, unspentOutputVector)
+	entry := DeserializeUnspentOutput(data)
+	checkRoundTrip(t, "unspent output", data, entry.Serialize())
+	if entry.Value != 20 || entry.Height != 0 || !entry.Coinbase {
+		t.Errorf("unspent output decoded to %+v", entry)
+	}
+}
+
+func TestUndoVector(t *testing.T) {
+	data := decodeVector(t, undoVector)
+	undo := DeserializeUndo(data)
+	checkRoundTrip(t, "undo record", data, undo.Serialize())
+	if len(undo.Spent) != 1 || hex.EncodeToString(undo.Spent[0].TxID) != coinbaseIDVector || undo.Spent[0].Index != 0 {
+		t.Errorf("undo record decoded to %+v", undo)
+	}
+}
+
+func TestDecodeRejectsMalformedData(t *testing.T) {
+	block := decodeVector(t, blockVector)
+	unspentOutput := decodeVector(t, unspentOutputVector)
+	badVersion := append([]byte{2}, block[1:]...)
+	badBool := append(append([]byte{}, unspentOutput[:len(unspentOutput)-1]...), 2)
+	tests := []struct {
+		name string
+		decode func() error
+		err error
+	}{
+		{"truncated block", func() error { _, err := DecodeBlock(block[:len(block)-1]); return err }, ErrMalformedData},
+		{"trailing bytes", func() error { _, err := DecodeBlock(append(block, 0)); return err }, ErrMalformedData},
+		{"unknown version", func() error { _, err := DecodeBlock(badVersion); return err }, ErrEncodingVersion},
+		{"oversized count", func() error { _, err := DecodeHeader([]byte{1, 0, 0, 0, 0, 0, 0, 0, 1, 0xff, 0xff, 0xff, 0xff}); return err }, ErrMalformedData},
+		{"empty transaction", func() error { _, err := DecodeTransaction(nil); return err }, ErrMalformedData},
+		{"bad boolean", func() error { d := NewDecoder(badBool); d.readUnspentOutput(); return d.Finish() }, ErrMalformedData},
+	}
+	for _, test := range tests {
+		if err := test.decode(); !errors.Is(err, test.err) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+	}
+}
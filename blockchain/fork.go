@@ -0,0 +1,256 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/rodolfoviolla/go-blockchain/handler"
+)
+
+var (
+	chainWorkPrefix = []byte("work-")
+	chainTipsPrefix = []byte("tip-")
+)
+
+func blockWork(difficulty int) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(difficulty))
+}
+
+func getChainWork(txn *badger.Txn, blockHash []byte) (*big.Int, error) {
+	item, err := txn.Get(append(chainWorkPrefix, blockHash...))
+	if err != nil {
+		return nil, err
+	}
+	work, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(work), nil
+}
+
+func (chain *BlockChain) GetChainWork(blockHash []byte) (*big.Int, error) {
+	var work *big.Int
+	err := chain.Database.View(func(txn *badger.Txn) error {
+		var err error
+		work, err = getChainWork(txn, blockHash)
+		return err
+	})
+	return work, err
+}
+
+func (chain *BlockChain) GetChainTips() [][]byte {
+	var tips [][]byte
+	handler.ErrorHandler(chain.Database.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		iterator := txn.NewIterator(opts)
+		defer iterator.Close()
+		for iterator.Seek(chainTipsPrefix); iterator.ValidForPrefix(chainTipsPrefix); iterator.Next() {
+			tips = append(tips, bytes.TrimPrefix(iterator.Item().KeyCopy(nil), chainTipsPrefix))
+		}
+		return nil
+	}))
+	return tips
+}
+
+// setTip moves the in-memory tip to hash once the database has been updated,
+// and wakes up whoever waits on TipChanged.
+func (chain *BlockChain) setTip(hash []byte) {
+	chain.tipMutex.Lock()
+	defer chain.tipMutex.Unlock()
+	chain.LastHash = hash
+	if chain.tipChanged != nil {
+		close(chain.tipChanged)
+		chain.tipChanged = nil
+	}
+}
+
+func (chain *BlockChain) TipChanged() <-chan struct{} {
+	chain.tipMutex.Lock()
+	defer chain.tipMutex.Unlock()
+	if chain.tipChanged == nil {
+		chain.tipChanged = make(chan struct{})
+	}
+	return chain.tipChanged
+}
+
+// connectBlock makes the block the new tip. The unspent outputs, the undo
+// record, the indexes and the tip are written in a single database
+// transaction, so a crash never leaves them at different blocks.
+func (chain *BlockChain) connectBlock(block *Block) error {
+	if err := chain.validateTransactions(block.Transactions, block.Height, !chain.isAssumedValid(block)); err != nil {
+		return err
+	}
+	unspentTxOutputsSet := UnspentTxOutputsSet{chain}
+	handler.ErrorHandler(chain.Database.Update(func(txn *badger.Txn) error {
+		undo := unspentTxOutputsSet.update(txn, block)
+		if chain.txIndex {
+			indexTransactions(txn, block)
+		}
+		if chain.addrIndex {
+			indexAddresses(txn, block, undo)
+		}
+		handler.ErrorHandler(txn.Set(heightKey(block.Height), block.Hash))
+		return txn.Set([]byte("lh"), block.Hash)
+	}))
+	chain.setTip(block.Hash)
+	if chain.OnBlockConnected != nil {
+		chain.OnBlockConnected(block)
+	}
+	return nil
+}
+
+func (chain *BlockChain) removeBlocks(blocks []*Block) {
+	handler.ErrorHandler(chain.Database.Update(func(txn *badger.Txn) error {
+		for _, block := range blocks {
+			handler.ErrorHandler(txn.Delete(block.Hash))
+			handler.ErrorHandler(txn.Delete(append(headerPrefix, block.Hash...)))
+			handler.ErrorHandler(txn.Delete(append(chainWorkPrefix, block.Hash...)))
+			handler.ErrorHandler(txn.Delete(append(chainTipsPrefix, block.Hash...)))
+			handler.ErrorHandler(txn.Delete(append(undoPrefix, block.Hash...)))
+		}
+		return nil
+	}))
+}
+
+// restoreChainTip marks hash as a chain tip again after its children were
+// removed by removeBlocks.
+func (chain *BlockChain) restoreChainTip(hash []byte) {
+	handler.ErrorHandler(chain.Database.Update(func(txn *badger.Txn) error {
+		return txn.Set(append(chainTipsPrefix, hash...), []byte{})
+	}))
+}
+
+// findFork walks both branches back to their common ancestor and returns the
+// main chain blocks to disconnect (tip first) and the side branch blocks to
+// connect (ancestor first).
+func (chain *BlockChain) findFork(newTip *Block) (disconnect, connect []*Block) {
+	oldTip := handler.ErrorHandler(chain.GetBlock(chain.LastHash))
+	oldBlock, newBlock := &oldTip, newTip
+	parent := func(block *Block) *Block {
+		prev := handler.ErrorHandler(chain.GetBlock(block.PrevHash))
+		return &prev
+	}
+	for oldBlock.Height > newBlock.Height {
+		disconnect = append(disconnect, oldBlock)
+		oldBlock = parent(oldBlock)
+	}
+	for newBlock.Height > oldBlock.Height {
+		connect = append([]*Block{newBlock}, connect...)
+		newBlock = parent(newBlock)
+	}
+	for !bytes.Equal(oldBlock.Hash, newBlock.Hash) {
+		disconnect = append(disconnect, oldBlock)
+		connect = append([]*Block{newBlock}, connect...)
+		oldBlock, newBlock = parent(oldBlock), parent(newBlock)
+	}
+	return
+}
+
+// disconnectBlock moves the tip back to the parent of the block, undoing
+// connectBlock in a single database transaction. Nothing is written when the
+// block has no undo record.
+func (chain *BlockChain) disconnectBlock(block *Block) error {
+	unspentTxOutputsSet := UnspentTxOutputsSet{chain}
+	err := chain.Database.Update(func(txn *badger.Txn) error {
+		undo, err := unspentTxOutputsSet.disconnect(txn, block)
+		if err != nil {
+			return err
+		}
+		if chain.addrIndex {
+			unindexAddresses(txn, block, undo)
+		}
+		chain.detachBlock(txn, block)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	chain.setTip(block.PrevHash)
+	return nil
+}
+
+// detachBlock removes the block from the transaction and height indexes and
+// moves the stored tip to its parent.
+func (chain *BlockChain) detachBlock(txn *badger.Txn, block *Block) {
+	if chain.txIndex {
+		unindexTransactions(txn, block)
+	}
+	handler.ErrorHandler(txn.Delete(heightKey(block.Height)))
+	handler.ErrorHandler(txn.Set([]byte("lh"), block.PrevHash))
+}
+
+// rewind disconnects the blocks, tip first. Once a block turns out to have no
+// undo record, the rest are only detached from the indexes and the unspent
+// outputs are rebuilt from the new tip.
+func (chain *BlockChain) rewind(disconnect []*Block) {
+	reindex := false
+	for _, block := range disconnect {
+		if !reindex {
+			if err := chain.disconnectBlock(block); err != nil {
+				fmt.Println(err)
+				reindex = true
+			}
+		}
+		if reindex {
+			handler.ErrorHandler(chain.Database.Update(func(txn *badger.Txn) error {
+				chain.detachBlock(txn, block)
+				return nil
+			}))
+			chain.setTip(block.PrevHash)
+		}
+		if chain.OnBlockDisconnected != nil {
+			chain.OnBlockDisconnected(block)
+		}
+	}
+	if reindex {
+		unspentTxOutputsSet := UnspentTxOutputsSet{chain}
+		unspentTxOutputsSet.ReIndex()
+	}
+}
+
+// activateBestChain connects the stored chain tip with the most work when it
+// has more than the current tip, which is the case after the node stopped
+// between storing a block and connecting it.
+func (chain *BlockChain) activateBestChain() {
+	bestWork := handler.ErrorHandler(chain.GetChainWork(chain.LastHash))
+	var best []byte
+	for _, tip := range chain.GetChainTips() {
+		if work, err := chain.GetChainWork(tip); err == nil && work.Cmp(bestWork) > 0 {
+			best, bestWork = tip, work
+		}
+	}
+	if best == nil {
+		return
+	}
+	block := handler.ErrorHandler(chain.GetBlock(best))
+	if err := chain.reorganize(&block); err != nil {
+		fmt.Printf("Rejected block %x: %s\n", best, err)
+	}
+}
+
+func (chain *BlockChain) reorganize(newTip *Block) error {
+	disconnect, connect := chain.findFork(newTip)
+	fmt.Printf("Reorganizing chain: disconnecting %d blocks, connecting %d blocks\n", len(disconnect), len(connect))
+	chain.rewind(disconnect)
+	for i, block := range connect {
+		if err := chain.connectBlock(block); err != nil {
+			reconnect := make([]*Block, 0, i)
+			for j := i - 1; j >= 0; j-- {
+				reconnect = append(reconnect, connect[j])
+			}
+			chain.rewind(reconnect)
+			for j := len(disconnect) - 1; j >= 0; j-- {
+				handler.ErrorHandler(chain.connectBlock(disconnect[j]))
+			}
+			chain.removeBlocks(connect[i:])
+			if i > 0 {
+				chain.restoreChainTip(block.PrevHash)
+			}
+			return err
+		}
+	}
+	return nil
+}
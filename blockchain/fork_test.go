@@ -0,0 +1,130 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/rodolfoviolla/go-blockchain/handler"
+	"github.com/rodolfoviolla/go-blockchain/params"
+	"github.com/rodolfoviolla/go-blockchain/wallet"
+)
+
+func hasChainTip(chain *BlockChain, hash []byte) bool {
+	for _, tip := range chain.GetChainTips() {
+		if bytes.Equal(tip, hash) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRejectedTipExtensionKeepsChainTip(t *testing.T) {
+	chain := newTestChain(t, params.RegTest)
+	w := wallet.MakeWallet()
+	mineBlocks(t, chain, w, 1)
+	tip := tipBlock(t, chain)
+	block := makeBlock(t, chain, &tip, []*Transaction{coinbaseTo(chain, w, tip.Height+1, 1)})
+	if err := chain.AddBlock(block); !errors.Is(err, ErrExcessCoinbase) {
+		t.Fatalf("got %v, want %v", err, ErrExcessCoinbase)
+	}
+	if !bytes.Equal(chain.LastHash, tip.Hash) {
+		t.Fatalf("tip moved to %x", chain.LastHash)
+	}
+	if !hasChainTip(chain, tip.Hash) || hasChainTip(chain, block.Hash) {
+		t.Fatalf("chain tips %x, want only %x", chain.GetChainTips(), tip.Hash)
+	}
+}
+
+func TestReorganizeRestoresSpentOutputs(t *testing.T) {
+	chain := newTestChain(t, params.RegTest)
+	w1, w2 := wallet.MakeWallet(), wallet.MakeWallet()
+	mineBlocks(t, chain, w1, chain.Params.CoinbaseMaturity+1)
+	fork := tipBlock(t, chain)
+	unspentTxOutputsSet := UnspentTxOutputsSet{chain}
+	before := unspentTxOutputsSet.Stats()
+	tx := NewTransaction(w1, string(w2.Address(chain.Params)), 5, 0, &unspentTxOutputsSet)
+	spending := makeBlock(t, chain, &fork, []*Transaction{coinbaseTo(chain, w1, fork.Height+1, 0), tx})
+	if err := chain.AddBlock(spending); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := unspentTxOutputsSet.FindOutput(tx.Inputs[0].ID, tx.Inputs[0].Out); err == nil {
+		t.Fatal("spent output is still in the set")
+	}
+	side := makeBlock(t, chain, &fork, []*Transaction{coinbaseTo(chain, w2, fork.Height+1, 0)})
+	if err := chain.AddBlock(side); err != nil {
+		t.Fatal(err)
+	}
+	longer := makeBlock(t, chain, side, []*Transaction{coinbaseTo(chain, w2, side.Height+1, 0)})
+	if err := chain.AddBlock(longer); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(chain.LastHash, longer.Hash) {
+		t.Fatalf("tip %x, want %x", chain.LastHash, longer.Hash)
+	}
+	if _, err := unspentTxOutputsSet.FindOutput(tx.Inputs[0].ID, tx.Inputs[0].Out); err != nil {
+		t.Fatalf("spent output was not restored: %s", err)
+	}
+	if _, err := unspentTxOutputsSet.FindOutput(tx.ID, 0); err == nil {
+		t.Fatal("output of the disconnected transaction is still in the set")
+	}
+	after := unspentTxOutputsSet.Stats()
+	if after.Outputs != before.Outputs+2 || after.TotalValue != before.TotalValue+2*chain.BlockSubsidy(fork.Height+1) {
+		t.Fatalf("set has %d outputs worth %d after the reorg", after.Outputs, after.TotalValue)
+	}
+	unspentTxOutputsSet.ReIndex()
+	if reindexed := unspentTxOutputsSet.Stats(); !bytes.Equal(after.Commitment, reindexed.Commitment) {
+		t.Fatalf("commitment %x after the reorg, %x after reindexing", after.Commitment, reindexed.Commitment)
+	}
+}
+
+func TestContinueConnectsStoredBestBlock(t *testing.T) {
+	chain := newTestChain(t, params.RegTest)
+	w := wallet.MakeWallet()
+	mineBlocks(t, chain, w, 1)
+	tip := tipBlock(t, chain)
+	block := makeBlock(t, chain, &tip, []*Transaction{coinbaseTo(chain, w, tip.Height+1, 0)})
+	if !chain.storeBlock(block) {
+		t.Fatal("block does not extend the best chain")
+	}
+	handler.ErrorHandler(chain.Database.Close())
+	reopened := ContinueBlockChain("test", chain.Params)
+	chain.Database = reopened.Database
+	if !bytes.Equal(reopened.LastHash, block.Hash) || reopened.GetBestHeight() != block.Height {
+		t.Fatalf("tip %x, want %x", reopened.LastHash, block.Hash)
+	}
+	unspentTxOutputsSet := UnspentTxOutputsSet{reopened}
+	if _, err := unspentTxOutputsSet.FindOutput(block.Transactions[0].ID, 0); err != nil {
+		t.Fatalf("coinbase of the stored block is not spendable: %s", err)
+	}
+	if hash, err := reopened.GetBlockHashByHeight(block.Height); err != nil || !bytes.Equal(hash, block.Hash) {
+		t.Fatalf("height %d is %x, want %x", block.Height, hash, block.Hash)
+	}
+}
+
+func TestConcurrentSiblingBlocks(t *testing.T) {
+	chain := newTestChain(t, params.RegTest)
+	genesis := tipBlock(t, chain)
+	var blocks []*Block
+	for i := 0; i < 2; i++ {
+		blocks = append(blocks, makeBlock(t, chain, &genesis, []*Transaction{coinbaseTo(chain, wallet.MakeWallet(), 1, 0)}))
+	}
+	errs := make(chan error, len(blocks))
+	for _, block := range blocks {
+		go func(block *Block) {
+			errs <- chain.AddBlock(block)
+		}(block)
+	}
+	for range blocks {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(chain.LastHash, blocks[0].Hash) && !bytes.Equal(chain.LastHash, blocks[1].Hash) {
+		t.Fatalf("tip %x is neither sibling", chain.LastHash)
+	}
+	unspentTxOutputsSet := UnspentTxOutputsSet{chain}
+	if total := unspentTxOutputsSet.TotalValue(); total != chain.IssuedSupply(1) {
+		t.Fatalf("unspent total %d, want %d", total, chain.IssuedSupply(1))
+	}
+}
@@ -0,0 +1,31 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/rodolfoviolla/go-blockchain/handler"
+	"github.com/rodolfoviolla/go-blockchain/params"
+)
+
+func GenesisBlock(chainParams *params.ChainParams) *Block {
+	pubKeyHash := handler.ErrorHandler(hex.DecodeString(chainParams.GenesisPubKeyHash))
+	txIn := TxInput{[]byte{}, -1, nil, append(ToHex(0), chainParams.GenesisData...)}
+	txOut := TxOutput{chainParams.InitialSubsidy, pubKeyHash}
+	coinbase := Transaction{nil, []TxInput{txIn}, []TxOutput{txOut}}
+	coinbase.ID = coinbase.Hash()
+	header := BlockHeader{BlockVersion, []byte{}, nil, chainParams.GenesisTimestamp, chainParams.InitialDifficulty, chainParams.GenesisNonce, 0, nil, nil}
+	block := &Block{header, nil, []*Transaction{&coinbase}}
+	block.MerkleRoot = block.HashTransactions()
+	block.Hash = block.BlockHeader.Hash()
+	return block
+}
+
+func checkGenesis(genesis *Block, chainParams *params.ChainParams) error {
+	expected := handler.ErrorHandler(hex.DecodeString(chainParams.GenesisHash))
+	if !bytes.Equal(genesis.Hash, expected) {
+		return fmt.Errorf("%s genesis block hashes to %x instead of %x", chainParams.Name, genesis.Hash, expected)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/rodolfoviolla/go-blockchain/handler"
+)
+
+const BlockVersion = 1
+
+var headerPrefix = []byte("header-")
+
+type BlockHeader struct {
+	Version int
+	PrevHash []byte
+	MerkleRoot []byte
+	Timestamp int64
+	Difficulty int
+	Nonce int
+	Height int
+	Signer []byte
+	Signature []byte
+}
+
+func (h *BlockHeader) HashData() []byte {
+	return bytes.Join(
+		[][]byte{
+			ToHex(int64(h.Version)),
+			h.PrevHash,
+			h.MerkleRoot,
+			ToHex(h.Timestamp),
+			ToHex(int64(h.Difficulty)),
+			ToHex(int64(h.Nonce)),
+			ToHex(int64(h.Height)),
+			h.Signer,
+		},
+		[]byte{},
+	)
+}
+
+func (h *BlockHeader) Hash() []byte {
+	hash := sha256.Sum256(h.HashData())
+	return hash[:]
+}
+
+func (h BlockHeader) Serialize() []byte {
+	encoder := NewEncoder()
+	encoder.writeHeader(&h)
+	return encoder.Bytes()
+}
+
+func DeserializeHeader(data []byte) *BlockHeader {
+	return handler.ErrorHandler(DecodeHeader(data))
+}
+
+func DecodeHeader(data []byte) (*BlockHeader, error) {
+	decoder := NewDecoder(data)
+	header := decoder.readHeader()
+	return &header, decoder.Finish()
+}
+
+func (chain *BlockChain) GetBlockHeader(blockHash []byte) (BlockHeader, error) {
+	var header BlockHeader
+	err := chain.Database.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(append(headerPrefix, blockHash...))
+		if err != nil {
+			return errors.New("Block header is not found")
+		}
+		header = *DeserializeHeader(handler.ErrorHandler(item.ValueCopy(nil)))
+		return nil
+	})
+	return header, err
+}
@@ -0,0 +1,67 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/rodolfoviolla/go-blockchain/handler"
+)
+
+var heightPrefix = []byte("height-")
+
+func heightKey(height int) []byte {
+	return append(append([]byte{}, heightPrefix...), ToHex(int64(height))...)
+}
+
+// reindexHeights rewrites the height index from the current tip back to the
+// genesis block.
+func (chain *BlockChain) reindexHeights() {
+	iterator := chain.Iterator()
+	for {
+		block := iterator.Next()
+		handler.ErrorHandler(chain.Database.Update(func(txn *badger.Txn) error {
+			return txn.Set(heightKey(block.Height), block.Hash)
+		}))
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+}
+
+func (chain *BlockChain) GetBlockHashByHeight(height int) ([]byte, error) {
+	var hash []byte
+	err := chain.Database.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(heightKey(height))
+		if err != nil {
+			return fmt.Errorf("no main chain block at height %d", height)
+		}
+		hash = handler.ErrorHandler(item.ValueCopy(nil))
+		return nil
+	})
+	return hash, err
+}
+
+func (chain *BlockChain) GetBlockByHeight(height int) (Block, error) {
+	hash, err := chain.GetBlockHashByHeight(height)
+	if err != nil {
+		return Block{}, err
+	}
+	return chain.GetBlock(hash)
+}
+
+// GetBlockRange returns the main chain blocks from height from to height to,
+// both included, oldest first.
+func (chain *BlockChain) GetBlockRange(from, to int) ([]Block, error) {
+	if from < 0 || from > to {
+		return nil, fmt.Errorf("invalid block range %d to %d", from, to)
+	}
+	var blocks []Block
+	for height := from; height <= to; height++ {
+		block, err := chain.GetBlockByHeight(height)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
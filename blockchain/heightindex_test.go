@@ -0,0 +1,69 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rodolfoviolla/go-blockchain/params"
+	"github.com/rodolfoviolla/go-blockchain/wallet"
+)
+
+func TestBlocksByHeight(t *testing.T) {
+	chain := newTestChain(t, params.RegTest)
+	w := wallet.MakeWallet()
+	mineBlocks(t, chain, w, 3)
+	blocks, err := chain.GetBlockRange(0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 4 || !bytes.Equal(blocks[3].Hash, chain.LastHash) {
+		t.Fatalf("range has %d blocks ending at %x, want 4 ending at %x", len(blocks), blocks[len(blocks)-1].Hash, chain.LastHash)
+	}
+	for height, block := range blocks {
+		if block.Height != height {
+			t.Fatalf("block %d of the range has height %d", height, block.Height)
+		}
+		byHeight, err := chain.GetBlockByHeight(height)
+		if err != nil || !bytes.Equal(byHeight.Hash, block.Hash) {
+			t.Fatalf("block at height %d is %x (%v), want %x", height, byHeight.Hash, err, block.Hash)
+		}
+	}
+	if blocks, err := chain.GetBlockRange(2, 2); err != nil || len(blocks) != 1 || blocks[0].Height != 2 {
+		t.Fatalf("range 2 to 2 has %d blocks (%v)", len(blocks), err)
+	}
+	if _, err := chain.GetBlockByHeight(4); err == nil {
+		t.Error("found a block above the tip")
+	}
+	for _, bounds := range [][2]int{{-1, 2}, {3, 2}, {2, 4}} {
+		if _, err := chain.GetBlockRange(bounds[0], bounds[1]); err == nil {
+			t.Errorf("range %d to %d did not fail", bounds[0], bounds[1])
+		}
+	}
+}
+
+func TestHeightIndexFollowsReorganizations(t *testing.T) {
+	chain := newTestChain(t, params.RegTest)
+	w := wallet.MakeWallet()
+	mineBlocks(t, chain, w, 2)
+	fork := tipBlock(t, chain)
+	mineBlocks(t, chain, w, 1)
+	side := makeBlock(t, chain, &fork, []*Transaction{coinbaseTo(chain, w, fork.Height+1, 0)})
+	if err := chain.AddBlock(side); err != nil {
+		t.Fatal(err)
+	}
+	longer := makeBlock(t, chain, side, []*Transaction{coinbaseTo(chain, w, side.Height+1, 0)})
+	if err := chain.AddBlock(longer); err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range []*Block{&fork, side, longer} {
+		hash, err := chain.GetBlockHashByHeight(block.Height)
+		if err != nil || !bytes.Equal(hash, block.Hash) {
+			t.Fatalf("block at height %d is %x (%v), want %x", block.Height, hash, err, block.Hash)
+		}
+	}
+	chain.reindexHeights()
+	blocks, err := chain.GetBlockRange(fork.Height, longer.Height)
+	if err != nil || len(blocks) != 3 || !bytes.Equal(blocks[1].Hash, side.Hash) || !bytes.Equal(blocks[2].Hash, longer.Hash) {
+		t.Fatalf("range after reindexing has %d blocks (%v)", len(blocks), err)
+	}
+}
@@ -0,0 +1,56 @@
+package blockchain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rodolfoviolla/go-blockchain/params"
+	"github.com/rodolfoviolla/go-blockchain/wallet"
+)
+
+// newTestChain creates a chain with the given network params in a temporary
+// directory, with its unspent transaction outputs set built.
+func newTestChain(t *testing.T, chainParams params.ChainParams) *BlockChain {
+	t.Helper()
+	chainParams.DataDir = t.TempDir()
+	chain := InitBlockChain("test", &chainParams)
+	t.Cleanup(func() { chain.Database.Close() })
+	unspentTxOutputsSet := UnspentTxOutputsSet{chain}
+	unspentTxOutputsSet.ReIndex()
+	return chain
+}
+
+func coinbaseTo(chain *BlockChain, w *wallet.Wallet, height, fees int) *Transaction {
+	return CoinbaseTx(string(w.Address(chain.Params)), "", chain.BlockSubsidy(height)+fees)
+}
+
+// mineBlocks mines n coinbase-only blocks paying w on top of the current tip.
+func mineBlocks(t *testing.T, chain *BlockChain, w *wallet.Wallet, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if _, err := chain.MineBlock(context.Background(), []*Transaction{coinbaseTo(chain, w, chain.GetBestHeight()+1, 0)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// makeBlock seals a block with the transactions on top of parent, without
+// adding it to the chain.
+func makeBlock(t *testing.T, chain *BlockChain, parent *Block, txs []*Transaction) *Block {
+	t.Helper()
+	block := NewBlock(txs, parent.Hash, parent.Height+1, chain.NextDifficulty(&parent.BlockHeader))
+	block.Timestamp = chain.MedianTimePast(&parent.BlockHeader) + 1
+	if err := block.Seal(context.Background(), chain.now, nil); err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+func tipBlock(t *testing.T, chain *BlockChain) Block {
+	t.Helper()
+	block, err := chain.GetBlock(chain.LastHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
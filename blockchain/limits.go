@@ -0,0 +1,32 @@
+package blockchain
+
+const (
+	MaxBlockSize = 1 << 20
+	MaxBlockSigOps = MaxBlockSize / 50
+	// BlockReservedSize leaves room for the header, the coinbase and the
+	// encoding overhead when a miner fills a block with transactions.
+	BlockReservedSize = 4096
+)
+
+func (tx *Transaction) Size() int {
+	return len(tx.Serialize())
+}
+
+func (tx *Transaction) SigOpCount() int {
+	if tx.IsCoinbase() {
+		return 0
+	}
+	return len(tx.Inputs)
+}
+
+func (b *Block) Size() int {
+	return len(b.Serialize())
+}
+
+func (b *Block) SigOpCount() int {
+	count := 0
+	for _, tx := range b.Transactions {
+		count += tx.SigOpCount()
+	}
+	return count
+}
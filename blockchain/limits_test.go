@@ -0,0 +1,35 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/rodolfoviolla/go-blockchain/params"
+	"github.com/rodolfoviolla/go-blockchain/wallet"
+)
+
+func TestBlockLimits(t *testing.T) {
+	chain := newTestChain(t, params.RegTest)
+	w := wallet.MakeWallet()
+	genesis := tipBlock(t, chain)
+	address := string(w.Address(chain.Params))
+	large := CoinbaseTx(address, strings.Repeat("x", MaxBlockSize), chain.BlockSubsidy(1))
+	if _, err := chain.MineBlock(context.Background(), []*Transaction{large}); !errors.Is(err, ErrBlockTooLarge) {
+		t.Errorf("mining a large block: got %v, want %v", err, ErrBlockTooLarge)
+	}
+	block := makeBlock(t, chain, &genesis, []*Transaction{large})
+	if err := chain.AddBlock(block); !errors.Is(err, ErrBlockTooLarge) {
+		t.Errorf("adding a large block: got %v, want %v", err, ErrBlockTooLarge)
+	}
+	spend := &Transaction{Inputs: make([]TxInput, MaxBlockSigOps+1), Outputs: []TxOutput{*NewTXOutput(1, address)}}
+	spend.ID = spend.Hash()
+	block = makeBlock(t, chain, &genesis, []*Transaction{coinbaseTo(chain, w, 1, 0), spend})
+	if err := chain.AddBlock(block); !errors.Is(err, ErrTooManySigOps) {
+		t.Errorf("adding a block with %d signature operations: got %v, want %v", block.SigOpCount(), err, ErrTooManySigOps)
+	}
+	if chain.GetBestHeight() != 0 {
+		t.Fatalf("height %d after rejecting every block", chain.GetBestHeight())
+	}
+}
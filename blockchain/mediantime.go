@@ -0,0 +1,30 @@
+package blockchain
+
+import (
+	"sort"
+	"time"
+
+	"github.com/rodolfoviolla/go-blockchain/handler"
+)
+
+const MedianTimeBlocks = 11
+
+func (chain *BlockChain) now() time.Time {
+	if chain.Now != nil {
+		return chain.Now()
+	}
+	return time.Now()
+}
+
+func (chain *BlockChain) MedianTimePast(header *BlockHeader) int64 {
+	timestamps := []int64{header.Timestamp}
+	for len(timestamps) < MedianTimeBlocks && len(header.PrevHash) > 0 {
+		parent := handler.ErrorHandler(chain.GetBlockHeader(header.PrevHash))
+		header = &parent
+		timestamps = append(timestamps, header.Timestamp)
+	}
+	sort.Slice(timestamps, func(i, j int) bool {
+		return timestamps[i] < timestamps[j]
+	})
+	return timestamps[len(timestamps)/2]
+}
@@ -0,0 +1,63 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rodolfoviolla/go-blockchain/params"
+	"github.com/rodolfoviolla/go-blockchain/wallet"
+)
+
+func TestBlockTimestampBoundaries(t *testing.T) {
+	chain := newTestChain(t, params.RegTest)
+	genesis := tipBlock(t, chain)
+	now := time.Unix(genesis.Timestamp+1000, 0)
+	chain.Now = func() time.Time { return now }
+	medianTime := chain.MedianTimePast(&genesis.BlockHeader)
+	maxTime := now.Unix() + chain.Params.MaxFutureBlockTime
+	tests := []struct {
+		timestamp int64
+		err error
+	}{
+		{medianTime - 1, ErrTimeTooOld},
+		{medianTime, ErrTimeTooOld},
+		{medianTime + 1, nil},
+		{maxTime, nil},
+		{maxTime + 1, ErrTimeTooNew},
+	}
+	w := wallet.MakeWallet()
+	for _, test := range tests {
+		block := makeBlock(t, chain, &genesis, []*Transaction{coinbaseTo(chain, w, 1, 0)})
+		block.Timestamp = test.timestamp
+		if err := block.Seal(context.Background(), chain.now, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := chain.ValidateBlock(block); !errors.Is(err, test.err) {
+			t.Errorf("timestamp %d: got %v, want %v", test.timestamp, err, test.err)
+		}
+	}
+}
+
+func TestRollHeaderReadsChainClock(t *testing.T) {
+	chain := newTestChain(t, params.RegTest)
+	genesis := tipBlock(t, chain)
+	now := time.Unix(genesis.Timestamp+5000, 0)
+	chain.Now = func() time.Time { return now }
+	block := NewBlock([]*Transaction{coinbaseTo(chain, wallet.MakeWallet(), 1, 0)}, genesis.Hash, 1, genesis.Difficulty)
+	block.Timestamp = genesis.Timestamp + 1
+	extraNonce, root := block.Transactions[0].ExtraNonce(), block.MerkleRoot
+	block.rollHeader(chain.now())
+	if block.Timestamp != now.Unix() {
+		t.Fatalf("timestamp %d, want %d", block.Timestamp, now.Unix())
+	}
+	if block.Transactions[0].ExtraNonce() != extraNonce+1 || bytes.Equal(block.MerkleRoot, root) {
+		t.Fatal("extra nonce was not rolled")
+	}
+	block.rollHeader(time.Unix(genesis.Timestamp, 0))
+	if block.Timestamp != now.Unix() {
+		t.Fatalf("timestamp moved back to %d", block.Timestamp)
+	}
+}
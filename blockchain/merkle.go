@@ -1,9 +1,15 @@
 package blockchain
 
-import "crypto/sha256"
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+)
 
 type MerkleTree struct {
 	RootNode *MerkleNode
+	levels [][]*MerkleNode
+	leaves int
 }
 
 type MerkleNode struct {
@@ -12,13 +18,27 @@ type MerkleNode struct {
 	Data []byte
 }
 
+// MerkleProofNode is one step of an inclusion proof: the sibling hash and
+// whether it sits on the left of the running hash.
+type MerkleProofNode struct {
+	Hash []byte
+	Left bool
+}
+
+// Leaves and inner nodes are hashed behind different prefixes, so that the
+// concatenation of two child hashes can never pass for a transaction.
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
 func NewMerkleNode(left, right *MerkleNode, data []byte) *MerkleNode {
 	node := MerkleNode{}
 	if left == nil && right == nil {
-		hash := sha256.Sum256(data)
+		hash := sha256.Sum256(append([]byte{merkleLeafPrefix}, data...))
 		node.Data = hash[:]
 	} else {
-		previousHashes := append(left.Data, right.Data...)
+		previousHashes := append(append([]byte{merkleNodePrefix}, left.Data...), right.Data...)
 		hash := sha256.Sum256(previousHashes)
 		node.Data = hash[:]
 	}
@@ -27,23 +47,58 @@ func NewMerkleNode(left, right *MerkleNode, data []byte) *MerkleNode {
 	return &node
 }
 
+// NewMerkleTree pairs the nodes of every level, repeating the last one when a
+// level has an odd count, until a single root is left. A tree without leaves
+// has the zero hash as its root and no proofs.
 func NewMerkleTree(data [][]byte) *MerkleTree {
-	var nodes []MerkleNode
-	if dataLen := len(data); dataLen%2 != 0 {
-		data = append(data, data[dataLen-1])
+	if len(data) == 0 {
+		return &MerkleTree{RootNode: &MerkleNode{Data: make([]byte, sha256.Size)}}
 	}
+	var nodes []*MerkleNode
 	for _, item := range data {
-		node := NewMerkleNode(nil, nil, item)
-		nodes = append(nodes, *node)
+		nodes = append(nodes, NewMerkleNode(nil, nil, item))
 	}
-	for i := 0; i < len(data)/2; i++ {
-		var level []MerkleNode
-		for j := 0; j < len(nodes); j +=2 {
-			node := NewMerkleNode(&nodes[j], &nodes[j+1], nil)
-			level = append(level, *node)
+	tree := MerkleTree{leaves: len(data)}
+	for {
+		if len(nodes)%2 != 0 {
+			nodes = append(nodes, nodes[len(nodes)-1])
+		}
+		tree.levels = append(tree.levels, nodes)
+		var level []*MerkleNode
+		for j := 0; j < len(nodes); j += 2 {
+			level = append(level, NewMerkleNode(nodes[j], nodes[j+1], nil))
 		}
 		nodes = level
+		if len(nodes) == 1 {
+			break
+		}
 	}
-	tree := MerkleTree{&nodes[0]}
+	tree.RootNode = nodes[0]
 	return &tree
-}
\ No newline at end of file
+}
+
+func (tree *MerkleTree) Proof(index int) ([]MerkleProofNode, error) {
+	if index < 0 || index >= tree.leaves {
+		return nil, fmt.Errorf("merkle tree has no leaf %d", index)
+	}
+	var proof []MerkleProofNode
+	for _, level := range tree.levels {
+		sibling := index ^ 1
+		proof = append(proof, MerkleProofNode{level[sibling].Data, sibling < index})
+		index /= 2
+	}
+	return proof, nil
+}
+
+func VerifyMerkleProof(root, leaf []byte, proof []MerkleProofNode) bool {
+	node := NewMerkleNode(nil, nil, leaf)
+	for _, step := range proof {
+		sibling := &MerkleNode{Data: step.Hash}
+		if step.Left {
+			node = NewMerkleNode(sibling, node, nil)
+		} else {
+			node = NewMerkleNode(node, sibling, nil)
+		}
+	}
+	return bytes.Equal(node.Data, root)
+}
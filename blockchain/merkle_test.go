@@ -0,0 +1,66 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestMerkleProofs(t *testing.T) {
+	for _, size := range []int{1, 2, 3, 4, 5, 7, 8} {
+		var data [][]byte
+		for i := 0; i < size; i++ {
+			data = append(data, []byte(fmt.Sprintf("tx %d", i)))
+		}
+		tree := NewMerkleTree(data)
+		root := tree.RootNode.Data
+		for i, leaf := range data {
+			proof, err := tree.Proof(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !VerifyMerkleProof(root, leaf, proof) {
+				t.Errorf("proof of leaf %d of %d does not verify", i, size)
+			}
+			if VerifyMerkleProof(root, []byte("other"), proof) {
+				t.Errorf("proof of leaf %d of %d verifies another leaf", i, size)
+			}
+			if len(proof) > 0 {
+				proof[0].Hash = NewMerkleNode(nil, nil, []byte("other")).Data
+				if VerifyMerkleProof(root, leaf, proof) {
+					t.Errorf("proof of leaf %d of %d verifies with a wrong sibling", i, size)
+				}
+			}
+		}
+		if _, err := tree.Proof(size); err == nil {
+			t.Errorf("proof of missing leaf %d of %d", size, size)
+		}
+		if _, err := tree.Proof(-1); err == nil {
+			t.Errorf("proof of leaf -1 of %d", size)
+		}
+	}
+}
+
+func TestMerkleProofRejectsInnerNodes(t *testing.T) {
+	data := [][]byte{[]byte("tx 0"), []byte("tx 1"), []byte("tx 2"), []byte("tx 3")}
+	tree := NewMerkleTree(data)
+	proof, err := tree.Proof(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner := tree.levels[1][0]
+	forged := append(append([]byte{}, inner.Left.Data...), inner.Right.Data...)
+	if VerifyMerkleProof(tree.RootNode.Data, forged, proof[1:]) {
+		t.Error("the children of an inner node verify as a leaf")
+	}
+}
+
+func TestEmptyMerkleTree(t *testing.T) {
+	tree := NewMerkleTree(nil)
+	if !bytes.Equal(tree.RootNode.Data, make([]byte, 32)) {
+		t.Errorf("empty tree root %x, want the zero hash", tree.RootNode.Data)
+	}
+	if _, err := tree.Proof(0); err == nil {
+		t.Error("proof of a leaf of an empty tree")
+	}
+}
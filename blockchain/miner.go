@@ -0,0 +1,88 @@
+package blockchain
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"math"
+	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrNonceSpaceExhausted = errors.New("no nonce satisfies the proof of work target")
+	ErrStaleTip = errors.New("chain tip changed while mining")
+)
+
+const (
+	MaxNonce = math.MaxUint32
+	hashRateInterval = time.Second
+	cancelCheckInterval = 1024
+)
+
+type solution struct {
+	nonce int
+	hash []byte
+}
+
+// Run searches the nonce space on runtime.NumCPU() workers, each one trying
+// every n-th nonce up to MaxNonce, until a hash below the target is found or
+// ctx is done.
+func (pow *ProofOfWork) Run(ctx context.Context) (int, []byte, error) {
+	searchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	workers := runtime.NumCPU()
+	found := make(chan solution, workers)
+	var hashes atomic.Int64
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func(nonce int) {
+			defer wg.Done()
+			var intHash big.Int
+			for tried := 0; nonce <= MaxNonce; nonce += workers {
+				if tried++; tried%cancelCheckInterval == 0 && searchCtx.Err() != nil {
+					return
+				}
+				hash := sha256.Sum256(pow.InitData(nonce))
+				hashes.Add(1)
+				intHash.SetBytes(hash[:])
+				if intHash.Cmp(pow.Target) == -1 {
+					found <- solution{nonce, hash[:]}
+					cancel()
+					return
+				}
+			}
+		}(worker)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	ticker := time.NewTicker(hashRateInterval)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-done:
+			select {
+			case s := <-found:
+				return s.nonce, s.hash, nil
+			default:
+			}
+			if err := ctx.Err(); err != nil {
+				return 0, nil, err
+			}
+			return 0, nil, ErrNonceSpaceExhausted
+		case now := <-ticker.C:
+			if pow.OnHashRate != nil {
+				pow.OnHashRate(float64(hashes.Swap(0)) / now.Sub(last).Seconds())
+			}
+			last = now
+		}
+	}
+}
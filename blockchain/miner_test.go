@@ -0,0 +1,63 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rodolfoviolla/go-blockchain/params"
+	"github.com/rodolfoviolla/go-blockchain/wallet"
+)
+
+func TestRunStopsWhenCancelled(t *testing.T) {
+	header := BlockHeader{Version: 1, Timestamp: time.Now().Unix(), Difficulty: MaxDifficulty}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, _, err := NewProof(&header).Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("miner took %s to stop", elapsed)
+	}
+}
+
+// blockingConsensus seals nothing: Seal reports on sealing and then waits for
+// its context to be cancelled.
+type blockingConsensus struct {
+	Consensus
+	sealing chan struct{}
+}
+
+func (c blockingConsensus) Seal(ctx context.Context, chain *BlockChain, block *Block) error {
+	close(c.sealing)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestMineBlockStopsOnTipChange(t *testing.T) {
+	chain := newTestChain(t, params.RegTest)
+	w := wallet.MakeWallet()
+	genesis := tipBlock(t, chain)
+	sibling := makeBlock(t, chain, &genesis, []*Transaction{coinbaseTo(chain, w, 1, 0)})
+	consensus := blockingConsensus{chain.Consensus, make(chan struct{})}
+	chain.Consensus = consensus
+	mined := make(chan error, 1)
+	go func() {
+		_, err := chain.MineBlock(context.Background(), []*Transaction{coinbaseTo(chain, w, 1, 0)})
+		mined <- err
+	}()
+	<-consensus.sealing
+	if err := chain.AddBlock(sibling); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-mined:
+		if !errors.Is(err, ErrStaleTip) {
+			t.Fatalf("got %v, want %v", err, ErrStaleTip)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("miner kept going after the tip changed")
+	}
+}
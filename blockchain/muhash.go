@@ -0,0 +1,59 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"math/big"
+)
+
+const muHashSize = 384
+
+// muHashPrime is the 3072-bit prime 2^3072 - 1103717.
+var muHashPrime = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 8*muHashSize), big.NewInt(1103717))
+
+// MuHash is a rolling hash of a set: the product of the hashes of its elements
+// modulo a prime. Elements can be added and removed in any order, so the hash
+// of a set does not depend on how it was built.
+type MuHash struct {
+	value *big.Int
+}
+
+func NewMuHash() *MuHash {
+	return &MuHash{big.NewInt(1)}
+}
+
+func DeserializeMuHash(data []byte) *MuHash {
+	return &MuHash{new(big.Int).SetBytes(data)}
+}
+
+// muHashElement expands the SHA-256 of the data into a 3072-bit number by
+// hashing it again with a one byte counter.
+func muHashElement(data []byte) *big.Int {
+	seed := sha256.Sum256(data)
+	var expanded []byte
+	for i := 0; i < muHashSize/sha256.Size; i++ {
+		hash := sha256.Sum256(append(seed[:], byte(i)))
+		expanded = append(expanded, hash[:]...)
+	}
+	return new(big.Int).Mod(new(big.Int).SetBytes(expanded), muHashPrime)
+}
+
+func (h *MuHash) Add(data []byte) {
+	h.value.Mul(h.value, muHashElement(data))
+	h.value.Mod(h.value, muHashPrime)
+}
+
+func (h *MuHash) Remove(data []byte) {
+	h.value.Mul(h.value, new(big.Int).ModInverse(muHashElement(data), muHashPrime))
+	h.value.Mod(h.value, muHashPrime)
+}
+
+func (h *MuHash) Serialize() []byte {
+	return h.value.FillBytes(make([]byte, muHashSize))
+}
+
+// Digest is the SHA-256 of the serialized state, the value two sets are
+// compared by.
+func (h *MuHash) Digest() []byte {
+	digest := sha256.Sum256(h.Serialize())
+	return digest[:]
+}
@@ -0,0 +1,47 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/rodolfoviolla/go-blockchain/params"
+)
+
+func TestMuHashOrderIndependence(t *testing.T) {
+	var elements [][]byte
+	for i := 0; i < 5; i++ {
+		elements = append(elements, []byte(fmt.Sprintf("output %d", i)))
+	}
+	forward, backward := NewMuHash(), NewMuHash()
+	for i := range elements {
+		forward.Add(elements[i])
+		backward.Add(elements[len(elements)-1-i])
+	}
+	if !bytes.Equal(forward.Digest(), backward.Digest()) {
+		t.Fatal("digest depends on the insertion order")
+	}
+	removed := NewMuHash()
+	for _, element := range append(elements, []byte("spent")) {
+		removed.Add(element)
+	}
+	removed.Remove([]byte("spent"))
+	if !bytes.Equal(removed.Digest(), forward.Digest()) {
+		t.Fatal("removing an element does not undo adding it")
+	}
+	if restored := DeserializeMuHash(forward.Serialize()); !bytes.Equal(restored.Digest(), forward.Digest()) {
+		t.Fatal("digest changes after a serialization round trip")
+	}
+}
+
+func TestMuHashVectors(t *testing.T) {
+	if digest := hex.EncodeToString(NewMuHash().Digest()); digest != "ab1642a5fbec142ed166521affcb32a1018793ccff8a30ce6b951a790f5d56a5" {
+		t.Errorf("empty set digest %s", digest)
+	}
+	chain := newTestChain(t, params.RegTest)
+	unspentTxOutputsSet := UnspentTxOutputsSet{chain}
+	if commitment := hex.EncodeToString(unspentTxOutputsSet.Stats().Commitment); commitment != "413c53827ec7df01f952764397d50985036d7c5deed4d7545cde16a8fedec16d" {
+		t.Errorf("regtest genesis commitment %s", commitment)
+	}
+}
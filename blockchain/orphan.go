@@ -0,0 +1,108 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	MaxOrphanBlocks = 100
+	MaxOrphanAge = 20 * time.Minute
+)
+
+type orphanBlock struct {
+	block *Block
+	received time.Time
+}
+
+type orphanPool struct {
+	mutex sync.Mutex
+	byHash map[string]*orphanBlock
+	byParent map[string][]*orphanBlock
+}
+
+func (pool *orphanPool) remove(orphan *orphanBlock) {
+	hash, parent := hex.EncodeToString(orphan.block.Hash), hex.EncodeToString(orphan.block.PrevHash)
+	delete(pool.byHash, hash)
+	siblings := pool.byParent[parent]
+	for i, sibling := range siblings {
+		if sibling == orphan {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+	if len(siblings) == 0 {
+		delete(pool.byParent, parent)
+	} else {
+		pool.byParent[parent] = siblings
+	}
+}
+
+// addOrphan keeps a block whose parent is not known yet, dropping expired
+// orphans and then the oldest ones once the pool is full.
+func (chain *BlockChain) addOrphan(block *Block) {
+	pool := &chain.orphans
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	if pool.byHash == nil {
+		pool.byHash = make(map[string]*orphanBlock)
+		pool.byParent = make(map[string][]*orphanBlock)
+	}
+	hash := hex.EncodeToString(block.Hash)
+	if _, ok := pool.byHash[hash]; ok {
+		return
+	}
+	now := chain.now()
+	var oldest *orphanBlock
+	for _, orphan := range pool.byHash {
+		if now.Sub(orphan.received) > MaxOrphanAge {
+			pool.remove(orphan)
+		} else if oldest == nil || orphan.received.Before(oldest.received) {
+			oldest = orphan
+		}
+	}
+	if len(pool.byHash) >= MaxOrphanBlocks {
+		pool.remove(oldest)
+	}
+	orphan := &orphanBlock{block, now}
+	pool.byHash[hash] = orphan
+	parent := hex.EncodeToString(block.PrevHash)
+	pool.byParent[parent] = append(pool.byParent[parent], orphan)
+}
+
+func (chain *BlockChain) takeOrphans(parentHash []byte) []*Block {
+	pool := &chain.orphans
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	var blocks []*Block
+	for _, orphan := range append([]*orphanBlock{}, pool.byParent[hex.EncodeToString(parentHash)]...) {
+		pool.remove(orphan)
+		blocks = append(blocks, orphan.block)
+	}
+	return blocks
+}
+
+// MissingParent walks up the orphans descending from the given block and
+// returns the hash of the first ancestor that has not been received.
+func (chain *BlockChain) MissingParent(blockHash []byte) []byte {
+	pool := &chain.orphans
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	for {
+		orphan, ok := pool.byHash[hex.EncodeToString(blockHash)]
+		if !ok {
+			return blockHash
+		}
+		blockHash = orphan.block.PrevHash
+	}
+}
+
+func (chain *BlockChain) connectOrphans(parentHash []byte) {
+	for _, block := range chain.takeOrphans(parentHash) {
+		if err := chain.acceptBlock(block); err != nil {
+			fmt.Printf("Rejected orphan block %x: %s\n", block.Hash, err)
+		}
+	}
+}
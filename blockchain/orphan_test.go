@@ -0,0 +1,56 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rodolfoviolla/go-blockchain/params"
+	"github.com/rodolfoviolla/go-blockchain/wallet"
+)
+
+func orphanCount(chain *BlockChain) int {
+	chain.orphans.mutex.Lock()
+	defer chain.orphans.mutex.Unlock()
+	return len(chain.orphans.byHash)
+}
+
+func TestOrphanPoolRequiresMinimumDifficulty(t *testing.T) {
+	chainParams := params.RegTest
+	chainParams.MinDifficulty = 4
+	chain := newTestChain(t, chainParams)
+	w := wallet.MakeWallet()
+	genesis := tipBlock(t, chain)
+	parent := makeBlock(t, chain, &genesis, []*Transaction{coinbaseTo(chain, w, 1, 0)})
+	if parent.Difficulty != chainParams.MinDifficulty {
+		t.Fatalf("difficulty %d, want the network minimum %d", parent.Difficulty, chainParams.MinDifficulty)
+	}
+	for _, difficulty := range []int{-5, 0, chainParams.MinDifficulty - 1} {
+		orphan := NewBlock([]*Transaction{coinbaseTo(chain, w, 2, 0)}, parent.Hash, 2, difficulty)
+		orphan.Hash = orphan.BlockHeader.Hash()
+		if err := chain.AddBlock(orphan); !errors.Is(err, ErrDifficultyOutOfRange) {
+			t.Errorf("difficulty %d: got %v, want %v", difficulty, err, ErrDifficultyOutOfRange)
+		}
+	}
+	if count := orphanCount(chain); count != 0 {
+		t.Fatalf("%d blocks without work entered the orphan pool", count)
+	}
+	orphan := NewBlock([]*Transaction{coinbaseTo(chain, w, 2, 0)}, parent.Hash, 2, chainParams.MinDifficulty)
+	orphan.Timestamp = parent.Timestamp + 1
+	if err := orphan.Seal(context.Background(), chain.now, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.AddBlock(orphan); !errors.Is(err, ErrUnknownParent) {
+		t.Fatalf("got %v, want %v", err, ErrUnknownParent)
+	}
+	if !bytes.Equal(chain.MissingParent(orphan.Hash), parent.Hash) {
+		t.Fatal("orphan is not waiting for its parent")
+	}
+	if err := chain.AddBlock(parent); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(chain.LastHash, orphan.Hash) || orphanCount(chain) != 0 {
+		t.Fatalf("orphan was not connected, tip %x", chain.LastHash)
+	}
+}
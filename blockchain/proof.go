@@ -2,64 +2,41 @@ package blockchain
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"encoding/binary"
-	"fmt"
-	"math"
 	"math/big"
 
 	"github.com/rodolfoviolla/go-blockchain/handler"
 )
 
-const Difficulty = 12
+const (
+	MinDifficulty = 1
+	MaxDifficulty = 255
+)
 
 type ProofOfWork struct {
-	Block *Block
+	Header *BlockHeader
 	Target *big.Int
+	OnHashRate func(float64)
 }
 
-func NewProof(b * Block) *ProofOfWork {
+func NewProof(h *BlockHeader) *ProofOfWork {
 	target := big.NewInt(1)
-	target.Lsh(target, uint(256-Difficulty))
-	return &ProofOfWork{b, target}
+	target.Lsh(target, uint(256-h.Difficulty))
+	return &ProofOfWork{Header: h, Target: target}
 }
 
 func (pow *ProofOfWork) InitData(nonce int) []byte {
-	return bytes.Join(
-		[][]byte{
-			pow.Block.PrevHash,
-			pow.Block.HashTransactions(),
-			ToHex(int64(nonce)),
-			ToHex(int64(Difficulty)),
-		},
-		[]byte{},
-	)
-}
-
-func (pow *ProofOfWork) Run() (int, []byte) {
-	var intHash big.Int
-	var hash [32]byte
-	nonce := 0
-	for nonce < math.MaxInt64 {
-		data := pow.InitData(nonce)
-		hash = sha256.Sum256(data)
-		fmt.Printf("\r%x", hash)
-		intHash.SetBytes(hash[:])
-		if intHash.Cmp(pow.Target) == -1 {
-			break
-		}	else {
-			nonce++
-		}
-	}
-	fmt.Println()
-	return nonce, hash[:]
+	header := *pow.Header
+	header.Nonce = nonce
+	return header.HashData()
 }
 
 func (pow *ProofOfWork) Validate() bool {
 	var intHash big.Int
-	data := pow.InitData(pow.Block.Nonce)
-	hash := sha256.Sum256(data)
-	intHash.SetBytes(hash[:])
+	if pow.Header.Nonce < 0 || pow.Header.Nonce > MaxNonce {
+		return false
+	}
+	intHash.SetBytes(pow.Header.Hash())
 	return intHash.Cmp(pow.Target) == -1
 }
 
@@ -0,0 +1,40 @@
+package blockchain
+
+func (chain *BlockChain) BlockSubsidy(height int) int {
+	halvings := height / chain.Params.HalvingInterval
+	if halvings >= 63 {
+		return 0
+	}
+	return chain.Params.InitialSubsidy >> halvings
+}
+
+func (chain *BlockChain) IssuedSupply(height int) int {
+	supply := 0
+	interval := chain.Params.HalvingInterval
+	for start := 0; start <= height; start += interval {
+		subsidy := chain.BlockSubsidy(start)
+		if subsidy == 0 {
+			break
+		}
+		blocks := interval
+		if height-start+1 < blocks {
+			blocks = height - start + 1
+		}
+		supply += subsidy * blocks
+	}
+	return supply
+}
+
+func (chain *BlockChain) MaxSupply() int {
+	supply := 0
+	for subsidy := chain.Params.InitialSubsidy; subsidy > 0; subsidy >>= 1 {
+		supply += subsidy * chain.Params.HalvingInterval
+	}
+	return supply
+}
+
+// MoneyRange reports whether value is a valid amount of coins: not negative
+// and not above the maximum supply.
+func (chain *BlockChain) MoneyRange(value int) bool {
+	return value >= 0 && value <= chain.MaxSupply()
+}
@@ -6,7 +6,7 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
-	"encoding/gob"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"log"
@@ -24,47 +24,72 @@ type Transaction struct {
 	Outputs []TxOutput
 }
 
+// Hash is the transaction id: the SHA-256 of the transaction without its id
+// and input signatures, so that signing the inputs does not change it.
 func (tx *Transaction) Hash() []byte {
-	var hash [32]byte
 	txCopy := *tx
 	txCopy.ID = []byte{}
-	hash = sha256.Sum256(txCopy.Serialize())
+	txCopy.Inputs = make([]TxInput, len(tx.Inputs))
+	for i, in := range tx.Inputs {
+		txCopy.Inputs[i] = TxInput{in.ID, in.Out, nil, in.PubKey}
+	}
+	hash := sha256.Sum256(txCopy.Serialize())
 	return hash[:]
 }
 
 func (tx Transaction) Serialize() []byte {
-	var encoded bytes.Buffer
-	enc := gob.NewEncoder(&encoded)
-	handler.ErrorHandler(enc.Encode(tx))
-	return encoded.Bytes()
+	encoder := NewEncoder()
+	encoder.writeTransaction(&tx)
+	return encoder.Bytes()
 }
 
 func DeserializeTransaction(data []byte) Transaction {
-	var transaction Transaction
-	decoder := gob.NewDecoder(bytes.NewReader(data))
-	handler.ErrorHandler(decoder.Decode(&transaction))
-	return transaction
+	return handler.ErrorHandler(DecodeTransaction(data))
+}
+
+func DecodeTransaction(data []byte) (Transaction, error) {
+	decoder := NewDecoder(data)
+	transaction := decoder.readTransaction()
+	return transaction, decoder.Finish()
 }
 
-func CoinbaseTx(to, data string) *Transaction {
+func CoinbaseTx(to, data string, value int) *Transaction {
 	if data == "" {
 		randomData := make([]byte, 24)
 		handler.ErrorHandler(rand.Read(randomData))
 		data = fmt.Sprintf("%x", randomData)
 	}
-	txIn := TxInput{[]byte{}, -1, nil, []byte(data)}
-	txOut := *NewTXOutput(20, to)
+	txIn := TxInput{[]byte{}, -1, nil, append(ToHex(0), data...)}
+	txOut := *NewTXOutput(value, to)
 	tx := Transaction{nil, []TxInput{txIn}, []TxOutput{txOut}}
 	tx.ID = tx.Hash()
 	return &tx
 }
 
-func NewTransaction(w *wallet.Wallet, to string, amount int, unspentTxOutputs *UnspentTxOutputsSet) *Transaction {
+func (tx *Transaction) ExtraNonce() int64 {
+	var extraNonce int64
+	handler.ErrorHandler(binary.Read(bytes.NewReader(tx.Inputs[0].PubKey), binary.BigEndian, &extraNonce))
+	return extraNonce
+}
+
+func (tx *Transaction) SetExtraNonce(extraNonce int64) {
+	copy(tx.Inputs[0].PubKey, ToHex(extraNonce))
+	tx.ID = tx.Hash()
+}
+
+func NewTransaction(w *wallet.Wallet, to string, amount, fee int, unspentTxOutputs *UnspentTxOutputsSet) *Transaction {
 	var inputs []TxInput
 	var outputs []TxOutput
 	pubKeyHash := wallet.PublicKeyHash(w.PublicKey)
-	acc, validOutputs := unspentTxOutputs.FindSpendableOutputs(pubKeyHash, amount)
-	if acc < amount {
+	acc, validOutputs := unspentTxOutputs.FindSpendableOutputs(pubKeyHash, amount+fee)
+	if acc < amount+fee {
+		balance := 0
+		for _, out := range unspentTxOutputs.FindUnspentTransactions(pubKeyHash) {
+			balance += out.Value
+		}
+		if balance >= amount+fee {
+			log.Panicf("Error: not enough mature funds, coinbase outputs can be spent %d blocks after they are mined", unspentTxOutputs.Blockchain.Params.CoinbaseMaturity)
+		}
 		log.Panic("Error: not enough funds")
 	}
 	for encodedTxID, outs := range validOutputs {
@@ -74,10 +99,10 @@ func NewTransaction(w *wallet.Wallet, to string, amount int, unspentTxOutputs *U
 			inputs = append(inputs, input)
 		}
 	}
-	from := string(w.Address())
+	from := string(w.Address(unspentTxOutputs.Blockchain.Params))
 	outputs = append(outputs, *NewTXOutput(amount, to))
-	if acc > amount {
-		outputs = append(outputs, *NewTXOutput(acc - amount, from))
+	if acc > amount+fee {
+		outputs = append(outputs, *NewTXOutput(acc - amount - fee, from))
 	}
 	tx := Transaction{nil, inputs, outputs}
 	tx.ID = tx.Hash()
@@ -85,6 +110,10 @@ func NewTransaction(w *wallet.Wallet, to string, amount int, unspentTxOutputs *U
 	return &tx
 }
 
+func (tx *Transaction) HasValidID() bool {
+	return bytes.Equal(tx.ID, tx.Hash())
+}
+
 func (tx *Transaction) IsCoinbase() bool {
 	return len(tx.Inputs) == 1 && len(tx.Inputs[0].ID) == 0 && tx.Inputs[0].Out == -1
 }
@@ -0,0 +1,37 @@
+package blockchain
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/rodolfoviolla/go-blockchain/params"
+	"github.com/rodolfoviolla/go-blockchain/wallet"
+)
+
+func newTransactionPanic(w *wallet.Wallet, to string, amount int, unspentTxOutputsSet *UnspentTxOutputsSet) (message string) {
+	defer func() {
+		message = fmt.Sprint(recover())
+	}()
+	NewTransaction(w, to, amount, 0, unspentTxOutputsSet)
+	return ""
+}
+
+func TestNewTransactionWithImmatureFunds(t *testing.T) {
+	chain := newTestChain(t, params.RegTest)
+	w1, w2 := wallet.MakeWallet(), wallet.MakeWallet()
+	mineBlocks(t, chain, w1, 1)
+	unspentTxOutputsSet := UnspentTxOutputsSet{chain}
+	to := string(w2.Address(chain.Params))
+	if message := newTransactionPanic(w1, to, 5, &unspentTxOutputsSet); !strings.Contains(message, "not enough mature funds") {
+		t.Errorf("got %q for immature funds", message)
+	}
+	if message := newTransactionPanic(w1, to, 500, &unspentTxOutputsSet); !strings.Contains(message, "not enough funds") {
+		t.Errorf("got %q for missing funds", message)
+	}
+	mineBlocks(t, chain, w2, chain.Params.CoinbaseMaturity)
+	tx := NewTransaction(w1, to, 5, 0, &unspentTxOutputsSet)
+	if !chain.VerifyTransaction(tx) {
+		t.Fatal("transaction spending mature funds does not verify")
+	}
+}
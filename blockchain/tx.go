@@ -2,7 +2,6 @@ package blockchain
 
 import (
 	"bytes"
-	"encoding/gob"
 
 	"github.com/rodolfoviolla/go-blockchain/handler"
 	"github.com/rodolfoviolla/go-blockchain/wallet"
@@ -13,8 +12,16 @@ type TxOutput struct {
 	PubKeyHash []byte
 }
 
-type TxOutputs struct {
-	Outputs []TxOutput
+// UnspentOutput is an entry of the unspent transaction outputs set: the output
+// itself plus the height and kind of the transaction that created it.
+type UnspentOutput struct {
+	TxOutput
+	Height int
+	Coinbase bool
+}
+
+func (entry UnspentOutput) IsMature(height, maturity int) bool {
+	return !entry.Coinbase || height-entry.Height >= maturity
 }
 
 type TxInput struct {
@@ -30,18 +37,17 @@ func NewTXOutput(value int, address string) *TxOutput {
 	return &txo
 }
 
-func (outs TxOutputs) Serialize() []byte {
-	var buffer bytes.Buffer
-	encode := gob.NewEncoder(&buffer)
-	handler.ErrorHandler(encode.Encode(outs))
-	return buffer.Bytes()
+func (entry UnspentOutput) Serialize() []byte {
+	encoder := NewEncoder()
+	encoder.writeUnspentOutput(&entry)
+	return encoder.Bytes()
 }
 
-func DeserializeOutputs(data []byte) TxOutputs {
-	var outputs TxOutputs
-	decode := gob.NewDecoder(bytes.NewReader(data))
-	handler.ErrorHandler(decode.Decode(&outputs))
-	return outputs
+func DeserializeUnspentOutput(data []byte) UnspentOutput {
+	decoder := NewDecoder(data)
+	entry := decoder.readUnspentOutput()
+	handler.ErrorHandler(decoder.Finish())
+	return entry
 }
 
 func (in *TxInput) UsesKey(pubKeyHash []byte) bool {
@@ -0,0 +1,100 @@
+package blockchain
+
+import (
+	"github.com/dgraph-io/badger/v3"
+	"github.com/rodolfoviolla/go-blockchain/handler"
+)
+
+var (
+	txIndexKey = []byte("txindex")
+	txIndexPrefix = []byte("txindex-")
+)
+
+// TxLocation is the value of the txindex-<txid> keys: the main chain block
+// holding the transaction and its position in that block.
+type TxLocation struct {
+	BlockHash []byte
+	Position int
+}
+
+func (location TxLocation) Serialize() []byte {
+	encoder := NewEncoder()
+	encoder.WriteBytes(location.BlockHash)
+	encoder.WriteInt(location.Position)
+	return encoder.Bytes()
+}
+
+func DeserializeTxLocation(data []byte) TxLocation {
+	var location TxLocation
+	decoder := NewDecoder(data)
+	location.BlockHash = decoder.ReadBytes()
+	location.Position = decoder.ReadInt()
+	handler.ErrorHandler(decoder.Finish())
+	return location
+}
+
+func txIndexEnabled(db *badger.DB) bool {
+	return db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(txIndexKey)
+		return err
+	}) == nil
+}
+
+func (chain *BlockChain) TxIndexEnabled() bool {
+	return chain.txIndex
+}
+
+func indexTransactions(txn *badger.Txn, block *Block) {
+	for i, tx := range block.Transactions {
+		location := TxLocation{block.Hash, i}
+		handler.ErrorHandler(txn.Set(append(txIndexPrefix, tx.ID...), location.Serialize()))
+	}
+}
+
+func unindexTransactions(txn *badger.Txn, block *Block) {
+	for _, tx := range block.Transactions {
+		handler.ErrorHandler(txn.Delete(append(txIndexPrefix, tx.ID...)))
+	}
+}
+
+func (chain *BlockChain) findIndexedTransaction(ID []byte) (Block, int, error) {
+	var location TxLocation
+	err := chain.Database.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(append(txIndexPrefix, ID...))
+		if err != nil {
+			return err
+		}
+		location = DeserializeTxLocation(handler.ErrorHandler(item.ValueCopy(nil)))
+		return nil
+	})
+	if err != nil {
+		return Block{}, 0, err
+	}
+	block, err := chain.GetBlock(location.BlockHash)
+	return block, location.Position, err
+}
+
+// ReindexTransactions rebuilds the transaction index from the main chain and
+// enables it, so that it is kept up to date as blocks are connected.
+func (chain *BlockChain) ReindexTransactions() int {
+	unspentTxOutputsSet := UnspentTxOutputsSet{chain}
+	unspentTxOutputsSet.DeleteByPrefix(txIndexPrefix)
+	count := 0
+	iterator := chain.Iterator()
+	for {
+		block := iterator.Next()
+		handler.ErrorHandler(chain.Database.Update(func(txn *badger.Txn) error {
+			indexTransactions(txn, block)
+			return nil
+		}))
+		count += len(block.Transactions)
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+	handler.ErrorHandler(chain.Database.Update(func(txn *badger.Txn) error {
+		return txn.Set(txIndexKey, []byte{})
+	}))
+	chain.txIndex = true
+	return count
+}
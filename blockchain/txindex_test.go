@@ -0,0 +1,64 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rodolfoviolla/go-blockchain/params"
+	"github.com/rodolfoviolla/go-blockchain/wallet"
+)
+
+func TestTransactionIndexFollowsReorganizations(t *testing.T) {
+	chain := newTestChain(t, params.RegTest)
+	w1, w2 := wallet.MakeWallet(), wallet.MakeWallet()
+	mineBlocks(t, chain, w1, chain.Params.CoinbaseMaturity+1)
+	fork := tipBlock(t, chain)
+	unspentTxOutputsSet := UnspentTxOutputsSet{chain}
+	tx := NewTransaction(w1, string(w2.Address(chain.Params)), 5, 0, &unspentTxOutputsSet)
+	spending := makeBlock(t, chain, &fork, []*Transaction{coinbaseTo(chain, w1, fork.Height+1, 0), tx})
+	if err := chain.AddBlock(spending); err != nil {
+		t.Fatal(err)
+	}
+	if chain.TxIndexEnabled() {
+		t.Fatal("transaction index is enabled before reindexing")
+	}
+	if count, want := chain.ReindexTransactions(), spending.Height+2; count != want {
+		t.Fatalf("indexed %d transactions, want %d", count, want)
+	}
+	if !chain.TxIndexEnabled() {
+		t.Fatal("transaction index is not enabled after reindexing")
+	}
+	block, position, err := chain.findIndexedTransaction(tx.ID)
+	if err != nil || !bytes.Equal(block.Hash, spending.Hash) || position != 1 {
+		t.Fatalf("index has %x at %d (%v), want %x at 1", block.Hash, position, err, spending.Hash)
+	}
+	if found, err := chain.FindTransaction(tx.ID); err != nil || !bytes.Equal(found.ID, tx.ID) {
+		t.Fatalf("found %x (%v), want %x", found.ID, err, tx.ID)
+	}
+	if found, err := chain.FindTransactionBlock(tx.ID); err != nil || !bytes.Equal(found.Hash, spending.Hash) {
+		t.Fatalf("found block %x (%v), want %x", found.Hash, err, spending.Hash)
+	}
+	side := makeBlock(t, chain, &fork, []*Transaction{coinbaseTo(chain, w2, fork.Height+1, 0)})
+	if err := chain.AddBlock(side); err != nil {
+		t.Fatal(err)
+	}
+	longer := makeBlock(t, chain, side, []*Transaction{coinbaseTo(chain, w2, side.Height+1, 0)})
+	if err := chain.AddBlock(longer); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := chain.findIndexedTransaction(tx.ID); err == nil {
+		t.Fatal("disconnected transaction is still indexed")
+	}
+	if _, err := chain.FindTransaction(tx.ID); err == nil {
+		t.Fatal("disconnected transaction is still found")
+	}
+	if _, err := chain.FindTransactionBlock(tx.ID); err == nil {
+		t.Fatal("block of the disconnected transaction is still found")
+	}
+	for _, connected := range []*Block{side, longer} {
+		coinbase := connected.Transactions[0]
+		if found, err := chain.FindTransactionBlock(coinbase.ID); err != nil || !bytes.Equal(found.Hash, connected.Hash) {
+			t.Fatalf("found block %x (%v) for %x, want %x", found.Hash, err, coinbase.ID, connected.Hash)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package blockchain
+
+import (
+	"github.com/dgraph-io/badger/v3"
+	"github.com/rodolfoviolla/go-blockchain/handler"
+)
+
+var undoPrefix = []byte("undo-")
+
+type SpentOutput struct {
+	TxID []byte
+	Index int
+	Output UnspentOutput
+}
+
+type BlockUndo struct {
+	Spent []SpentOutput
+}
+
+func (undo BlockUndo) Serialize() []byte {
+	encoder := NewEncoder()
+	encoder.WriteCount(len(undo.Spent))
+	for _, spent := range undo.Spent {
+		encoder.WriteBytes(spent.TxID)
+		encoder.WriteInt(spent.Index)
+		encoder.writeUnspentOutput(&spent.Output)
+	}
+	return encoder.Bytes()
+}
+
+func DeserializeUndo(data []byte) BlockUndo {
+	var undo BlockUndo
+	decoder := NewDecoder(data)
+	count := decoder.ReadCount()
+	for i := 0; i < count && decoder.err == nil; i++ {
+		txID := decoder.ReadBytes()
+		index := decoder.ReadInt()
+		undo.Spent = append(undo.Spent, SpentOutput{txID, index, decoder.readUnspentOutput()})
+	}
+	handler.ErrorHandler(decoder.Finish())
+	return undo
+}
+
+// getBlockUndo returns the outputs a main chain block spent from earlier blocks.
+func (chain *BlockChain) getBlockUndo(blockHash []byte) (BlockUndo, error) {
+	var undo BlockUndo
+	err := chain.Database.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(append(undoPrefix, blockHash...))
+		if err != nil {
+			return err
+		}
+		undo = DeserializeUndo(handler.ErrorHandler(item.ValueCopy(nil)))
+		return nil
+	})
+	return undo, err
+}
@@ -2,38 +2,82 @@ package blockchain
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/hex"
+	"fmt"
 
 	"github.com/dgraph-io/badger/v3"
 	"github.com/rodolfoviolla/go-blockchain/handler"
 )
 
-var unspentTxOutputsPrefix = []byte("utxo-")
+var (
+	unspentTxOutputsPrefix = []byte("utxo-")
+	unspentTxOutputsHashKey = []byte("utxohash")
+)
+
+// Every unspent output is stored under its own outpoint: the prefix, the id of
+// the transaction and the index of the output in it.
+func unspentOutputKey(txID []byte, index int) []byte {
+	key := append(append([]byte{}, unspentTxOutputsPrefix...), txID...)
+	return append(key, ToHex(int64(index))...)
+}
+
+func parseUnspentOutputKey(key []byte) ([]byte, int) {
+	key = bytes.TrimPrefix(key, unspentTxOutputsPrefix)
+	txID := key[:len(key)-8]
+	index := int(int64(binary.BigEndian.Uint64(key[len(key)-8:])))
+	return txID, index
+}
 
+// The commitment covers every unspent output as its key, without the prefix,
+// followed by its serialized entry.
+func unspentOutputElement(key []byte, entry *UnspentOutput) []byte {
+	element := append([]byte{}, bytes.TrimPrefix(key, unspentTxOutputsPrefix)...)
+	return append(element, entry.Serialize()...)
+}
+
+func readUnspentTxOutputsHash(txn *badger.Txn) *MuHash {
+	item, err := txn.Get(unspentTxOutputsHashKey)
+	if err == badger.ErrKeyNotFound {
+		return NewMuHash()
+	}
+	handler.ErrorHandler(err)
+	return DeserializeMuHash(handler.ErrorHandler(item.ValueCopy(nil)))
+}
 
 type UnspentTxOutputsSet struct {
 	Blockchain *BlockChain
 }
 
+type UnspentTxOutputsStats struct {
+	TipHash []byte
+	Height int
+	Transactions int
+	Outputs int
+	TotalValue int
+	Size int
+	Commitment []byte
+}
+
 func (u *UnspentTxOutputsSet) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int) {
 	unspentOuts := make(map[string][]int)
 	accumulated := 0
+	height := u.Blockchain.GetBestHeight() + 1
 	db := u.Blockchain.Database
 	handler.ErrorHandler(db.View(func(txn *badger.Txn) error {
 		opts := badger.DefaultIteratorOptions
 		iterator := txn.NewIterator(opts)
 		defer iterator.Close()
-		for iterator.Seek(unspentTxOutputsPrefix); iterator.ValidForPrefix(unspentTxOutputsPrefix); iterator.Next() {
+		for iterator.Seek(unspentTxOutputsPrefix); iterator.ValidForPrefix(unspentTxOutputsPrefix) && accumulated < amount; iterator.Next() {
 			item := iterator.Item()
-			key := bytes.TrimPrefix(item.Key(), unspentTxOutputsPrefix)
-			txID := hex.EncodeToString(key)
-			outs := DeserializeOutputs(handler.ErrorHandler(item.ValueCopy(nil)))
-			for outIdx, out := range outs.Outputs {
-				if out.IsLockedWithKey(pubKeyHash) && accumulated < amount {
-					accumulated += out.Value
-					unspentOuts[txID] = append(unspentOuts[txID], outIdx)
-				}
+			entry := DeserializeUnspentOutput(handler.ErrorHandler(item.ValueCopy(nil)))
+			if !entry.IsMature(height, u.Blockchain.Params.CoinbaseMaturity) || !entry.IsLockedWithKey(pubKeyHash) {
+				continue
 			}
+			txID, index := parseUnspentOutputKey(item.Key())
+			encodedTxID := hex.EncodeToString(txID)
+			accumulated += entry.Value
+			unspentOuts[encodedTxID] = append(unspentOuts[encodedTxID], index)
 		}
 		return nil
 	}))
@@ -48,12 +92,9 @@ func (u *UnspentTxOutputsSet) FindUnspentTransactions(pubKeyHash []byte) []TxOut
 		iterator := txn.NewIterator(opts)
 		defer iterator.Close()
 		for iterator.Seek(unspentTxOutputsPrefix); iterator.ValidForPrefix(unspentTxOutputsPrefix); iterator.Next() {
-			item := iterator.Item()
-			outs := DeserializeOutputs(handler.ErrorHandler(item.ValueCopy(nil)))
-			for _, out := range outs.Outputs {
-				if out.IsLockedWithKey(pubKeyHash) {
-					unspentTransactionsOutput = append(unspentTransactionsOutput, out)
-				}
+			entry := DeserializeUnspentOutput(handler.ErrorHandler(iterator.Item().ValueCopy(nil)))
+			if entry.IsLockedWithKey(pubKeyHash) {
+				unspentTransactionsOutput = append(unspentTransactionsOutput, entry.TxOutput)
 			}
 		}
 		return nil
@@ -61,15 +102,52 @@ func (u *UnspentTxOutputsSet) FindUnspentTransactions(pubKeyHash []byte) []TxOut
 	return unspentTransactionsOutput
 }
 
+func (u *UnspentTxOutputsSet) FindOutput(txID []byte, index int) (UnspentOutput, error) {
+	var entry UnspentOutput
+	err := u.Blockchain.Database.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(unspentOutputKey(txID, index))
+		if err != nil {
+			return err
+		}
+		entry = DeserializeUnspentOutput(handler.ErrorHandler(item.ValueCopy(nil)))
+		return nil
+	})
+	return entry, err
+}
+
+func (u UnspentTxOutputsSet) TotalValue() int {
+	db := u.Blockchain.Database
+	total := 0
+	handler.ErrorHandler(db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		iterator := txn.NewIterator(opts)
+		defer iterator.Close()
+		for iterator.Seek(unspentTxOutputsPrefix); iterator.ValidForPrefix(unspentTxOutputsPrefix); iterator.Next() {
+			entry := DeserializeUnspentOutput(handler.ErrorHandler(iterator.Item().ValueCopy(nil)))
+			total += entry.Value
+		}
+		return nil
+	}))
+	return total
+}
+
+// CountTransactions counts the transactions with at least one unspent output.
+// Their outputs are stored next to each other, so only the keys are read.
 func (u UnspentTxOutputsSet) CountTransactions() int {
 	db := u.Blockchain.Database
 	counter := 0
 	handler.ErrorHandler(db.View(func(txn *badger.Txn) error {
 		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
 		iterator := txn.NewIterator(opts)
 		defer iterator.Close()
+		var lastTxID []byte
 		for iterator.Seek(unspentTxOutputsPrefix); iterator.ValidForPrefix(unspentTxOutputsPrefix); iterator.Next() {
-			counter++
+			txID, _ := parseUnspentOutputKey(iterator.Item().KeyCopy(nil))
+			if !bytes.Equal(txID, lastTxID) {
+				counter++
+				lastTxID = txID
+			}
 		}
 		return nil
 	}))
@@ -81,47 +159,132 @@ func (u UnspentTxOutputsSet) ReIndex() {
 	u.DeleteByPrefix(unspentTxOutputsPrefix)
 	unspentTxOutputs := u.Blockchain.FindUnspentTransactionOutputs()
 	handler.ErrorHandler(db.Update(func(txn *badger.Txn) error {
-		for txId, outs := range unspentTxOutputs {
-			key, err := hex.DecodeString(txId)
+		hash := NewMuHash()
+		for txId, entries := range unspentTxOutputs {
+			txID, err := hex.DecodeString(txId)
 			if err != nil {
 				return err
 			}
-			key = append(unspentTxOutputsPrefix, key...)
-			handler.ErrorHandler(txn.Set(key, outs.Serialize()))
+			for index, entry := range entries {
+				key := unspentOutputKey(txID, index)
+				handler.ErrorHandler(txn.Set(key, entry.Serialize()))
+				hash.Add(unspentOutputElement(key, &entry))
+			}
 		}
-		return nil
+		return txn.Set(unspentTxOutputsHashKey, hash.Serialize())
 	}))
 }
 
-func (u *UnspentTxOutputsSet) Update(block *Block) {
+// Stats summarizes the set at the current tip: the transactions and outputs in
+// it, their value, the bytes its keys and entries take and its commitment.
+func (u UnspentTxOutputsSet) Stats() UnspentTxOutputsStats {
+	var stats UnspentTxOutputsStats
 	db := u.Blockchain.Database
-	handler.ErrorHandler(db.Update(func(txn *badger.Txn) error {
-		for _, tx := range block.Transactions {
-			if !tx.IsCoinbase() {
-				for _, in := range tx.Inputs {
-					updatedOuts := TxOutputs{}
-					inID := append(unspentTxOutputsPrefix, in.ID...)
-					item := handler.ErrorHandler(txn.Get(inID))					
-					outs := DeserializeOutputs(handler.ErrorHandler(item.ValueCopy(nil)))
-					for outIdx, out := range outs.Outputs {
-						if outIdx != in.Out {
-							updatedOuts.Outputs = append(updatedOuts.Outputs, out)
-						}
-					}
-					if len(updatedOuts.Outputs) == 0 {
-						handler.ErrorHandler(txn.Delete(inID))
-					} else {
-						handler.ErrorHandler(txn.Set(inID, updatedOuts.Serialize()))
-					}
-				}
+	handler.ErrorHandler(db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte("lh"))
+		if err != nil {
+			return err
+		}
+		stats.TipHash = handler.ErrorHandler(item.ValueCopy(nil))
+		stats.Commitment = readUnspentTxOutputsHash(txn).Digest()
+		opts := badger.DefaultIteratorOptions
+		iterator := txn.NewIterator(opts)
+		defer iterator.Close()
+		var lastTxID []byte
+		for iterator.Seek(unspentTxOutputsPrefix); iterator.ValidForPrefix(unspentTxOutputsPrefix); iterator.Next() {
+			item := iterator.Item()
+			value := handler.ErrorHandler(item.ValueCopy(nil))
+			txID, _ := parseUnspentOutputKey(item.KeyCopy(nil))
+			if !bytes.Equal(txID, lastTxID) {
+				stats.Transactions++
+				lastTxID = txID
 			}
-			newOutputs := TxOutputs{}
-			newOutputs.Outputs = append(newOutputs.Outputs, tx.Outputs...)
-			txID := append(unspentTxOutputsPrefix, tx.ID...)
-			handler.ErrorHandler(txn.Set(txID, newOutputs.Serialize()))
+			stats.Outputs++
+			stats.TotalValue += DeserializeUnspentOutput(value).Value
+			stats.Size += len(item.Key()) + len(value)
 		}
 		return nil
 	}))
+	header := handler.ErrorHandler(u.Blockchain.GetBlockHeader(stats.TipHash))
+	stats.Height = header.Height
+	return stats
+}
+
+func (u *UnspentTxOutputsSet) Update(block *Block) {
+	handler.ErrorHandler(u.Blockchain.Database.Update(func(txn *badger.Txn) error {
+		u.update(txn, block)
+		return nil
+	}))
+}
+
+// update spends the inputs and adds the outputs of the block, and stores and
+// returns the undo record of the outputs it spent from earlier blocks.
+func (u *UnspentTxOutputsSet) update(txn *badger.Txn, block *Block) BlockUndo {
+	undo := BlockUndo{}
+	hash := readUnspentTxOutputsHash(txn)
+	created := make(map[string]bool)
+	for _, tx := range block.Transactions {
+		if !tx.IsCoinbase() {
+			for _, in := range tx.Inputs {
+				key := unspentOutputKey(in.ID, in.Out)
+				item := handler.ErrorHandler(txn.Get(key))
+				entry := DeserializeUnspentOutput(handler.ErrorHandler(item.ValueCopy(nil)))
+				if !created[hex.EncodeToString(in.ID)] {
+					undo.Spent = append(undo.Spent, SpentOutput{in.ID, in.Out, entry})
+				}
+				hash.Remove(unspentOutputElement(key, &entry))
+				handler.ErrorHandler(txn.Delete(key))
+			}
+		}
+		for index, out := range tx.Outputs {
+			entry := UnspentOutput{out, block.Height, tx.IsCoinbase()}
+			key := unspentOutputKey(tx.ID, index)
+			handler.ErrorHandler(txn.Set(key, entry.Serialize()))
+			hash.Add(unspentOutputElement(key, &entry))
+		}
+		created[hex.EncodeToString(tx.ID)] = true
+	}
+	handler.ErrorHandler(txn.Set(unspentTxOutputsHashKey, hash.Serialize()))
+	handler.ErrorHandler(txn.Set(append(undoPrefix, block.Hash...), undo.Serialize()))
+	return undo
+}
+
+func (u *UnspentTxOutputsSet) Disconnect(block *Block) error {
+	return u.Blockchain.Database.Update(func(txn *badger.Txn) error {
+		_, err := u.disconnect(txn, block)
+		return err
+	})
+}
+
+// disconnect removes the outputs of the block and restores the ones it spent
+// from its undo record, which it deletes and returns.
+func (u *UnspentTxOutputsSet) disconnect(txn *badger.Txn, block *Block) (BlockUndo, error) {
+	undoKey := append(undoPrefix, block.Hash...)
+	item, err := txn.Get(undoKey)
+	if err != nil {
+		return BlockUndo{}, fmt.Errorf("no undo data for block %x: %w", block.Hash, err)
+	}
+	undo := DeserializeUndo(handler.ErrorHandler(item.ValueCopy(nil)))
+	hash := readUnspentTxOutputsHash(txn)
+	for _, tx := range block.Transactions {
+		for index := range tx.Outputs {
+			key := unspentOutputKey(tx.ID, index)
+			item, err := txn.Get(key)
+			if err == badger.ErrKeyNotFound {
+				continue
+			}
+			entry := DeserializeUnspentOutput(handler.ErrorHandler(item.ValueCopy(nil)))
+			hash.Remove(unspentOutputElement(key, &entry))
+			handler.ErrorHandler(txn.Delete(key))
+		}
+	}
+	for _, spent := range undo.Spent {
+		key := unspentOutputKey(spent.TxID, spent.Index)
+		handler.ErrorHandler(txn.Set(key, spent.Output.Serialize()))
+		hash.Add(unspentOutputElement(key, &spent.Output))
+	}
+	handler.ErrorHandler(txn.Set(unspentTxOutputsHashKey, hash.Serialize()))
+	return undo, txn.Delete(undoKey)
 }
 
 func (unspentTxOutputs *UnspentTxOutputsSet) DeleteByPrefix(prefix []byte) {
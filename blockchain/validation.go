@@ -0,0 +1,222 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNoTransactions = errors.New("block has no transactions")
+	ErrBadHash = errors.New("block hash does not match its header")
+	ErrBadProofOfWork = errors.New("block hash does not satisfy its proof of work")
+	ErrBadDifficulty = errors.New("block difficulty does not match the required difficulty")
+	ErrDifficultyOutOfRange = errors.New("block difficulty is outside the allowed range")
+	ErrUnknownParent = errors.New("parent block is unknown")
+	ErrBadHeight = errors.New("block height does not follow its parent")
+	ErrTimeTooOld = errors.New("block timestamp is not after the median time past")
+	ErrTimeTooNew = errors.New("block timestamp is too far in the future")
+	ErrBadMerkleRoot = errors.New("merkle root does not match the block transactions")
+	ErrBadCoinbase = errors.New("block must start with exactly one coinbase transaction")
+	ErrBadTransactionID = errors.New("transaction id does not match its contents")
+	ErrDoubleSpend = errors.New("output is spent twice inside the block")
+	ErrMissingInput = errors.New("transaction input is not an unspent output")
+	ErrInvalidSignature = errors.New("transaction signature is invalid")
+	ErrImmatureCoinbase = errors.New("coinbase output spent before maturity")
+	ErrBadOutputValue = errors.New("transaction output value is not positive or exceeds the maximum supply")
+	ErrValueOutOfRange = errors.New("transaction amounts exceed the maximum supply")
+	ErrInsufficientInputs = errors.New("transaction outputs exceed its inputs")
+	ErrExcessCoinbase = errors.New("coinbase pays more than the subsidy plus fees")
+	ErrDuplicateTransaction = errors.New("transaction id still has unspent outputs")
+	ErrBlockTooLarge = errors.New("block exceeds the maximum size")
+	ErrTooManySigOps = errors.New("block exceeds the maximum signature operations")
+)
+
+func (chain *BlockChain) CheckBlockHeader(header *BlockHeader, hash []byte) error {
+	if !bytes.Equal(header.Hash(), hash) {
+		return fmt.Errorf("%w: %x", ErrBadHash, hash)
+	}
+	if header.Difficulty < chain.minimumDifficulty() {
+		return fmt.Errorf("%w: %d is below %d", ErrDifficultyOutOfRange, header.Difficulty, chain.minimumDifficulty())
+	}
+	return chain.Consensus.VerifySeal(header)
+}
+
+func (chain *BlockChain) CheckBlock(block *Block) error {
+	if len(block.Transactions) == 0 {
+		return ErrNoTransactions
+	}
+	if size := block.Size(); size > MaxBlockSize {
+		return fmt.Errorf("%w: %d bytes", ErrBlockTooLarge, size)
+	}
+	if sigOps := block.SigOpCount(); sigOps > MaxBlockSigOps {
+		return fmt.Errorf("%w: %d", ErrTooManySigOps, sigOps)
+	}
+	if err := chain.CheckBlockHeader(&block.BlockHeader, block.Hash); err != nil {
+		return err
+	}
+	if !bytes.Equal(block.MerkleRoot, block.HashTransactions()) {
+		return fmt.Errorf("%w: %x", ErrBadMerkleRoot, block.Hash)
+	}
+	if coinbase := block.Transactions[0]; !coinbase.IsCoinbase() || len(coinbase.Inputs[0].PubKey) < 8 {
+		return fmt.Errorf("%w: missing extra nonce", ErrBadCoinbase)
+	}
+	spent := make(map[string]bool)
+	for i, tx := range block.Transactions {
+		if tx.IsCoinbase() != (i == 0) {
+			return fmt.Errorf("%w: transaction %d", ErrBadCoinbase, i)
+		}
+		if err := chain.CheckTransaction(tx); err != nil {
+			return err
+		}
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, in := range tx.Inputs {
+			outpoint := fmt.Sprintf("%x:%d", in.ID, in.Out)
+			if spent[outpoint] {
+				return fmt.Errorf("%w: %s", ErrDoubleSpend, outpoint)
+			}
+			spent[outpoint] = true
+		}
+	}
+	return nil
+}
+
+// CheckTransaction runs the checks that need nothing but the transaction: its
+// id and the range of its output values.
+func (chain *BlockChain) CheckTransaction(tx *Transaction) error {
+	if !tx.HasValidID() {
+		return fmt.Errorf("%w: %x", ErrBadTransactionID, tx.ID)
+	}
+	total := 0
+	for _, out := range tx.Outputs {
+		if out.Value <= 0 || !chain.MoneyRange(out.Value) {
+			return fmt.Errorf("%w: %x", ErrBadOutputValue, tx.ID)
+		}
+		if total += out.Value; !chain.MoneyRange(total) {
+			return fmt.Errorf("%w: %x", ErrValueOutOfRange, tx.ID)
+		}
+	}
+	return nil
+}
+
+func (chain *BlockChain) checkHeaderContext(header *BlockHeader, hash []byte) error {
+	parent, err := chain.GetBlockHeader(header.PrevHash)
+	if err != nil {
+		return fmt.Errorf("%w: %x", ErrUnknownParent, header.PrevHash)
+	}
+	if err := chain.checkCheckpoints(header, hash); err != nil {
+		return err
+	}
+	if header.Height != parent.Height+1 {
+		return fmt.Errorf("%w: %d after %d", ErrBadHeight, header.Height, parent.Height)
+	}
+	if difficulty := chain.NextDifficulty(&parent); header.Difficulty != difficulty {
+		return fmt.Errorf("%w: %d instead of %d", ErrBadDifficulty, header.Difficulty, difficulty)
+	}
+	if medianTime := chain.MedianTimePast(&parent); header.Timestamp <= medianTime {
+		return fmt.Errorf("%w: %d is not after %d", ErrTimeTooOld, header.Timestamp, medianTime)
+	}
+	if maxTime := chain.now().Unix() + chain.Params.MaxFutureBlockTime; header.Timestamp > maxTime {
+		return fmt.Errorf("%w: %d is after %d", ErrTimeTooNew, header.Timestamp, maxTime)
+	}
+	return nil
+}
+
+func (chain *BlockChain) ValidateHeader(header *BlockHeader, hash []byte) error {
+	if err := chain.CheckBlockHeader(header, hash); err != nil {
+		return err
+	}
+	return chain.checkHeaderContext(header, hash)
+}
+
+func (chain *BlockChain) ValidateBlock(block *Block) error {
+	if err := chain.CheckBlock(block); err != nil {
+		return err
+	}
+	return chain.checkHeaderContext(&block.BlockHeader, block.Hash)
+}
+
+// ValidateTransactions checks the spends of a block built on the current tip
+// against the unspent transaction outputs set.
+func (chain *BlockChain) ValidateTransactions(transactions []*Transaction, height int) error {
+	return chain.validateTransactions(transactions, height, true)
+}
+
+func (chain *BlockChain) validateTransactions(transactions []*Transaction, height int, checkSignatures bool) error {
+	unspentTxOutputsSet := UnspentTxOutputsSet{chain}
+	blockTXs := make(map[string]Transaction)
+	fees := 0
+	// Connecting a transaction whose id still has unspent outputs would
+	// overwrite them, as two identical coinbases at different heights would.
+	for _, tx := range transactions {
+		for index := range tx.Outputs {
+			if _, err := unspentTxOutputsSet.FindOutput(tx.ID, index); err == nil {
+				return fmt.Errorf("%w: %x", ErrDuplicateTransaction, tx.ID)
+			}
+		}
+	}
+	for _, tx := range transactions[1:] {
+		prevTXs := make(map[string]Transaction)
+		inputs, outputs := 0, 0
+		for _, in := range tx.Inputs {
+			txID := hex.EncodeToString(in.ID)
+			var spent TxOutput
+			prevTX, inBlock := blockTXs[txID]
+			if inBlock {
+				if in.Out < 0 || in.Out >= len(prevTX.Outputs) {
+					return fmt.Errorf("%w: %s:%d", ErrMissingInput, txID, in.Out)
+				}
+				spent = prevTX.Outputs[in.Out]
+			} else {
+				entry, err := unspentTxOutputsSet.FindOutput(in.ID, in.Out)
+				if err != nil {
+					return fmt.Errorf("%w: %s:%d", ErrMissingInput, txID, in.Out)
+				}
+				if !entry.IsMature(height, chain.Params.CoinbaseMaturity) {
+					return fmt.Errorf("%w: %s at height %d", ErrImmatureCoinbase, txID, height)
+				}
+				spent = entry.TxOutput
+				if checkSignatures {
+					if prevTX, err = chain.FindTransaction(in.ID); err != nil {
+						return fmt.Errorf("%w: %s:%d", ErrMissingInput, txID, in.Out)
+					}
+				}
+			}
+			if checkSignatures && !in.UsesKey(spent.PubKeyHash) {
+				return fmt.Errorf("%w: %x", ErrInvalidSignature, tx.ID)
+			}
+			prevTXs[txID] = prevTX
+			if inputs += spent.Value; !chain.MoneyRange(spent.Value) || !chain.MoneyRange(inputs) {
+				return fmt.Errorf("%w: %x", ErrValueOutOfRange, tx.ID)
+			}
+		}
+		for _, out := range tx.Outputs {
+			if outputs += out.Value; !chain.MoneyRange(out.Value) || !chain.MoneyRange(outputs) {
+				return fmt.Errorf("%w: %x", ErrValueOutOfRange, tx.ID)
+			}
+		}
+		if outputs > inputs {
+			return fmt.Errorf("%w: %x", ErrInsufficientInputs, tx.ID)
+		}
+		if fees += inputs - outputs; !chain.MoneyRange(fees) {
+			return fmt.Errorf("%w: %x", ErrValueOutOfRange, tx.ID)
+		}
+		if checkSignatures && !tx.Verify(prevTXs) {
+			return fmt.Errorf("%w: %x", ErrInvalidSignature, tx.ID)
+		}
+		blockTXs[hex.EncodeToString(tx.ID)] = *tx
+	}
+	reward := 0
+	for _, out := range transactions[0].Outputs {
+		if reward += out.Value; !chain.MoneyRange(out.Value) || !chain.MoneyRange(reward) {
+			return fmt.Errorf("%w: %x", ErrValueOutOfRange, transactions[0].ID)
+		}
+	}
+	if allowed := chain.BlockSubsidy(height) + fees; reward > allowed {
+		return fmt.Errorf("%w: %d instead of %d", ErrExcessCoinbase, reward, allowed)
+	}
+	return nil
+}
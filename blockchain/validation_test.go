@@ -0,0 +1,65 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/rodolfoviolla/go-blockchain/params"
+	"github.com/rodolfoviolla/go-blockchain/wallet"
+)
+
+func TestOutputValuesOutsideMoneyRange(t *testing.T) {
+	chain := newTestChain(t, params.RegTest)
+	w := wallet.MakeWallet()
+	genesis := tipBlock(t, chain)
+	maxSupply := chain.MaxSupply()
+	tests := []struct {
+		values []int
+		err error
+	}{
+		{[]int{math.MaxInt64, math.MaxInt64}, ErrBadOutputValue},
+		{[]int{maxSupply + 1}, ErrBadOutputValue},
+		{[]int{maxSupply, 1}, ErrValueOutOfRange},
+		{[]int{0}, ErrBadOutputValue},
+	}
+	for _, test := range tests {
+		coinbase := coinbaseTo(chain, w, 1, 0)
+		coinbase.Outputs = nil
+		for _, value := range test.values {
+			coinbase.Outputs = append(coinbase.Outputs, TxOutput{value, wallet.PublicKeyHash(w.PublicKey)})
+		}
+		coinbase.ID = coinbase.Hash()
+		block := makeBlock(t, chain, &genesis, []*Transaction{coinbase})
+		if err := chain.AddBlock(block); !errors.Is(err, test.err) {
+			t.Errorf("outputs %v: got %v, want %v", test.values, err, test.err)
+		}
+	}
+	unspentTxOutputsSet := UnspentTxOutputsSet{chain}
+	if total := unspentTxOutputsSet.TotalValue(); total != chain.IssuedSupply(0) {
+		t.Fatalf("unspent total %d, want %d", total, chain.IssuedSupply(0))
+	}
+}
+
+func TestDuplicateCoinbase(t *testing.T) {
+	chain := newTestChain(t, params.RegTest)
+	w := wallet.MakeWallet()
+	coinbase := CoinbaseTx(string(w.Address(chain.Params)), "same", chain.BlockSubsidy(1))
+	genesis := tipBlock(t, chain)
+	first := makeBlock(t, chain, &genesis, []*Transaction{coinbase})
+	if err := chain.AddBlock(first); err != nil {
+		t.Fatal(err)
+	}
+	second := makeBlock(t, chain, first, []*Transaction{coinbase})
+	if err := chain.AddBlock(second); !errors.Is(err, ErrDuplicateTransaction) {
+		t.Fatalf("got %v, want %v", err, ErrDuplicateTransaction)
+	}
+	if _, err := chain.MineBlock(context.Background(), []*Transaction{coinbase}); !errors.Is(err, ErrDuplicateTransaction) {
+		t.Fatalf("mining got %v, want %v", err, ErrDuplicateTransaction)
+	}
+	unspentTxOutputsSet := UnspentTxOutputsSet{chain}
+	if total := unspentTxOutputsSet.TotalValue(); total != chain.IssuedSupply(1) {
+		t.Fatalf("unspent total %d, want %d", total, chain.IssuedSupply(1))
+	}
+}
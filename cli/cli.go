@@ -1,37 +1,57 @@
 package cli
 
 import (
+	"context"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"runtime"
 	"strconv"
+	"strings"
 
 	"github.com/rodolfoviolla/go-blockchain/blockchain"
 	"github.com/rodolfoviolla/go-blockchain/color"
 	"github.com/rodolfoviolla/go-blockchain/handler"
 	"github.com/rodolfoviolla/go-blockchain/network"
+	"github.com/rodolfoviolla/go-blockchain/params"
 	"github.com/rodolfoviolla/go-blockchain/wallet"
 )
 
-type CommandLine struct {}
+type CommandLine struct {
+	params *params.ChainParams
+}
 
 const (
 	GET_BALANCE_CMD = "get-balance"
 	CREATE_BLOCKCHAIN_CMD = "create-blockchain"
 	PRINT_CHAIN_CMD = "print-chain"
 	SEND_CMD = "send"
+	GENERATE_CMD = "generate"
 	CREATE_WALLET_CMD = "create-wallet"
 	LIST_ADDRESSES_CMD = "list-addresses"
 	REINDEX_UTXO_CMD = "reindex-utxo"
+	REINDEX_TXINDEX_CMD = "reindex-txindex"
+	REINDEX_ADDRINDEX_CMD = "reindex-addrindex"
+	ADDRESS_HISTORY_CMD = "address-history"
 	START_NODE_CMD = "start-node"
+	GET_SUPPLY_CMD = "get-supply"
+	UTXO_STATS_CMD = "utxo-stats"
+	GET_MERKLE_PROOF_CMD = "get-merkle-proof"
 	ADDRESS_PARAM = "address"
 	FROM_PARAM = "from"
 	TO_PARAM = "to"
 	AMOUNT_PARAM = "amount"
+	FEE_PARAM = "fee"
 	MINE_PARAM = "mine"
 	MINER_PARAM = "miner"
+	NETWORK_PARAM = "network"
+	TXID_PARAM = "txid"
+	PAGE_PARAM = "page"
+	PAGE_SIZE_PARAM = "page-size"
+	BLOCKS_PARAM = "blocks"
+	SIGNERS_PARAM = "signers"
 )
 
 func (cli *CommandLine) printUsage() {
@@ -39,13 +59,24 @@ func (cli *CommandLine) printUsage() {
 	fmt.Println()
 	fmt.Println("Usage:")
 	fmt.Println(color.Green + "  " + GET_BALANCE_CMD + " " + color.Cyan + "-" + ADDRESS_PARAM + " " + color.Yellow + "ADDRESS           " + color.Reset + "- Gets the balance for an address")
-	fmt.Println(color.Green + "  " + CREATE_BLOCKCHAIN_CMD + " " + color.Cyan + "-" + ADDRESS_PARAM + " " + color.Yellow + "ADDRESS     " + color.Reset + "- Creates a blockchain and sends genesis reward to address")
+	fmt.Println(color.Green + "  " + CREATE_BLOCKCHAIN_CMD + "                      " + color.Reset + "- Creates a blockchain from the network genesis block")
 	fmt.Println(color.Green + "  " + PRINT_CHAIN_CMD + "                            " + color.Reset + "- Prints the blocks in the chain")
-	fmt.Println(color.Green + "  " + SEND_CMD + " " + color.Cyan + "-" + FROM_PARAM + " " + color.Yellow + "FROM " + color.Cyan + "-" + TO_PARAM + " " + color.Yellow + "TO " + color.Cyan + "-" + AMOUNT_PARAM + " " + color.Yellow + "AMOUNT  "+ color.Cyan + "-" + MINE_PARAM + color.Reset + "- Send amount of coins")
+	fmt.Println(color.Green + "  " + SEND_CMD + " " + color.Cyan + "-" + FROM_PARAM + " " + color.Yellow + "FROM " + color.Cyan + "-" + TO_PARAM + " " + color.Yellow + "TO " + color.Cyan + "-" + AMOUNT_PARAM + " " + color.Yellow + "AMOUNT " + color.Cyan + "-" + FEE_PARAM + " " + color.Yellow + "FEE " + color.Cyan + "-" + MINE_PARAM + " " + color.Reset + "- Send amount of coins")
+	fmt.Println(color.Green + "  " + GENERATE_CMD + " " + color.Cyan + "-" + ADDRESS_PARAM + " " + color.Yellow + "ADDRESS " + color.Cyan + "-" + BLOCKS_PARAM + " " + color.Yellow + "N    " + color.Reset + "- Mines N blocks with only a coinbase paying ADDRESS")
 	fmt.Println(color.Green + "  " + CREATE_WALLET_CMD + "                          " + color.Reset + "- Creates a new wallet")
 	fmt.Println(color.Green + "  " + LIST_ADDRESSES_CMD + "                         " + color.Reset + "- List the addresses in our wallet file")
 	fmt.Println(color.Green + "  " + REINDEX_UTXO_CMD + "                           " + color.Reset + "- Rebuilds the unspent transaction outputs set")
+	fmt.Println(color.Green + "  " + REINDEX_TXINDEX_CMD + "                        " + color.Reset + "- Rebuilds the transaction index and keeps it up to date")
+	fmt.Println(color.Green + "  " + REINDEX_ADDRINDEX_CMD + "                      " + color.Reset + "- Rebuilds the address index and keeps it up to date")
+	fmt.Println(color.Green + "  " + ADDRESS_HISTORY_CMD + " " + color.Cyan + "-" + ADDRESS_PARAM + " " + color.Yellow + "ADDRESS " + color.Cyan + "-" + PAGE_PARAM + " " + color.Yellow + "PAGE " + color.Cyan + "-" + PAGE_SIZE_PARAM + " " + color.Yellow + "SIZE " + color.Reset + "- Lists the transactions that paid or spent from an address")
+	fmt.Println(color.Green + "  " + GET_SUPPLY_CMD + "                             " + color.Reset + "- Prints the circulating and maximum coin supply")
+	fmt.Println(color.Green + "  " + UTXO_STATS_CMD + "                             " + color.Reset + "- Prints the size and commitment of the unspent transaction outputs set")
+	fmt.Println(color.Green + "  " + GET_MERKLE_PROOF_CMD + " " + color.Cyan + "-" + TXID_PARAM + " " + color.Yellow + "TXID         " + color.Reset + "- Prints the proof that a transaction is included in its block")
 	fmt.Println(color.Green + "  " + START_NODE_CMD + "                           " + color.Cyan + "-" + MINER_PARAM + " " + color.Yellow + "ADDRESS " + color.Reset + "- Start a node with ID specified in NODE_ID environment variable. To enable mining, pass " + color.Cyan + "-miner " + color.Reset + "param")
+	fmt.Println()
+	fmt.Println("Every command accepts " + color.Cyan + "-" + NETWORK_PARAM + " " + color.Yellow + "NETWORK" + color.Reset + " to select mainnet (default), testnet or regtest")
+	fmt.Println("and " + color.Cyan + "-" + SIGNERS_PARAM + " " + color.Yellow + "ADDRESS,ADDRESS" + color.Reset + " to run a proof of authority chain signed in turn by those addresses.")
+	fmt.Println("The signers given to " + CREATE_BLOCKCHAIN_CMD + " are stored with the chain and used when the flag is left out.")
 }
 
 func (cli * CommandLine) validateArgs() {
@@ -58,7 +89,7 @@ func (cli * CommandLine) validateArgs() {
 func (cli *CommandLine) StartNode(nodeId, minerAddress string) {
 	fmt.Printf("Starting Node %s\n", nodeId)
 	if len(minerAddress) > 0 {
-		if wallet.ValidateAddress(minerAddress) {
+		if wallet.ValidateAddress(minerAddress, cli.params) {
 			fmt.Println("Mining is on. Address to receive rewards: ", minerAddress)
 		} else {
 			log.Panic("Wrong miner address!")
@@ -68,7 +99,7 @@ func (cli *CommandLine) StartNode(nodeId, minerAddress string) {
 }
 
 func (cli *CommandLine) reIndexUnspentTxOutputs(nodeId string) {
-	chain := blockchain.ContinueBlockChain(nodeId)
+	chain := blockchain.ContinueBlockChain(nodeId, cli.params)
 	defer chain.Database.Close()
 	unspentTxOutputsSet := blockchain.UnspentTxOutputsSet{Blockchain: chain}
 	unspentTxOutputsSet.ReIndex()
@@ -76,15 +107,107 @@ func (cli *CommandLine) reIndexUnspentTxOutputs(nodeId string) {
 	fmt.Printf(color.Green + "Done! There are " + color.Reset + "%d" + color.Green + " transactions in the unspent transaction outputs set.\n", count)
 }
 
+func (cli *CommandLine) reIndexTransactions(nodeId string) {
+	chain := blockchain.ContinueBlockChain(nodeId, cli.params)
+	defer chain.Database.Close()
+	count := chain.ReindexTransactions()
+	fmt.Printf(color.Green + "Done! There are " + color.Reset + "%d" + color.Green + " transactions in the transaction index.\n", count)
+}
+
+func (cli *CommandLine) reIndexAddresses(nodeId string) {
+	chain := blockchain.ContinueBlockChain(nodeId, cli.params)
+	defer chain.Database.Close()
+	count := chain.ReindexAddresses()
+	fmt.Printf(color.Green + "Done! There are " + color.Reset + "%d" + color.Green + " entries in the address index.\n", count)
+}
+
+func (cli *CommandLine) addressHistory(address string, page, pageSize int, nodeId string) {
+	if !wallet.ValidateAddress(address, cli.params) {
+		log.Panic("Address is not valid")
+	}
+	chain := blockchain.ContinueBlockChain(nodeId, cli.params)
+	defer chain.Database.Close()
+	if !chain.AddrIndexEnabled() {
+		fmt.Println("Address index is not enabled, run " + REINDEX_ADDRINDEX_CMD + " first")
+		runtime.Goexit()
+	}
+	pubKeyHash := wallet.Base58Decode([]byte(address))
+	pubKeyHash = pubKeyHash[1:len(pubKeyHash)-4]
+	history, total := chain.AddressHistory(pubKeyHash, (page-1)*pageSize, pageSize)
+	pages := (total + pageSize - 1) / pageSize
+	fmt.Printf("History of " + color.Yellow + "%s" + color.Reset + ", page %d of %d, %d entries\n", address, page, pages, total)
+	for _, entry := range history {
+		amount := fmt.Sprintf(color.Green + "+%d", entry.Amount)
+		if entry.Sent {
+			amount = fmt.Sprintf(color.Red + "-%d", entry.Amount)
+		}
+		fmt.Printf("%8d  %x  %s\n" + color.Reset, entry.Height, entry.TxID, amount)
+	}
+}
+
+func (cli *CommandLine) getSupply(nodeId string) {
+	chain := blockchain.ContinueBlockChain(nodeId, cli.params)
+	defer chain.Database.Close()
+	unspentTxOutputsSet := blockchain.UnspentTxOutputsSet{Blockchain: chain}
+	height := chain.GetBestHeight()
+	fmt.Printf("Height             " + color.Yellow + "%d\n" + color.Reset, height)
+	fmt.Printf("Circulating supply " + color.Green + "%d\n" + color.Reset, unspentTxOutputsSet.TotalValue())
+	fmt.Printf("Issued supply      " + color.Green + "%d\n" + color.Reset, chain.IssuedSupply(height))
+	fmt.Printf("Next block subsidy " + color.Green + "%d\n" + color.Reset, chain.BlockSubsidy(height+1))
+	fmt.Printf("Maximum supply     " + color.Green + "%d\n" + color.Reset, chain.MaxSupply())
+}
+
+func (cli *CommandLine) utxoStats(nodeId string) {
+	chain := blockchain.ContinueBlockChain(nodeId, cli.params)
+	defer chain.Database.Close()
+	unspentTxOutputsSet := blockchain.UnspentTxOutputsSet{Blockchain: chain}
+	stats := unspentTxOutputsSet.Stats()
+	fmt.Printf("Height       " + color.Yellow + "%d\n" + color.Reset, stats.Height)
+	fmt.Printf("Tip          %x\n", stats.TipHash)
+	fmt.Printf("Transactions " + color.Yellow + "%d\n" + color.Reset, stats.Transactions)
+	fmt.Printf("Outputs      " + color.Yellow + "%d\n" + color.Reset, stats.Outputs)
+	fmt.Printf("Total value  " + color.Green + "%d\n" + color.Reset, stats.TotalValue)
+	fmt.Printf("Size         " + color.Yellow + "%d bytes\n" + color.Reset, stats.Size)
+	fmt.Printf("Commitment   " + color.Cyan + "%x\n" + color.Reset, stats.Commitment)
+}
+
+func (cli *CommandLine) getMerkleProof(txID, nodeId string) {
+	id, err := hex.DecodeString(txID)
+	if err != nil {
+		log.Panic("Transaction id is not valid")
+	}
+	chain := blockchain.ContinueBlockChain(nodeId, cli.params)
+	defer chain.Database.Close()
+	block := handler.ErrorHandler(chain.FindTransactionBlock(id))
+	index, proof, err := block.MerkleProof(id)
+	handler.ErrorHandler(err)
+	leaf := block.Transactions[index].Serialize()
+	fmt.Printf("Block        " + color.Yellow + "%x\n" + color.Reset, block.Hash)
+	fmt.Printf("Height       %d\n", block.Height)
+	fmt.Printf("Merkle root  %x\n", block.MerkleRoot)
+	fmt.Printf("Transaction  " + color.Yellow + "%x\n" + color.Reset, id)
+	fmt.Printf("Index        %d\n", index)
+	fmt.Printf("Leaf         %x\n", leaf)
+	for _, step := range proof {
+		side := "right"
+		if step.Left {
+			side = "left "
+		}
+		fmt.Printf("  " + color.Cyan + "%s" + color.Reset + "      %x\n", side, step.Hash)
+	}
+	verified := blockchain.VerifyMerkleProof(block.MerkleRoot, leaf, proof)
+	fmt.Printf("Verified     " + color.Green + "%s\n" + color.Reset, strconv.FormatBool(verified))
+}
+
 func (cli *CommandLine) createWallet(nodeId string) {
-	wallets, _ := wallet.CreateWallets(nodeId)
+	wallets, _ := wallet.CreateWallets(nodeId, cli.params)
 	address := wallets.AddWallet()
 	wallets.SaveFile(nodeId)
 	fmt.Printf("New address is: " + color.Yellow + "%s\n", address)
 }
 
 func (cli *CommandLine) listAddresses(nodeId string) {
-	wallets, _ := wallet.CreateWallets(nodeId)
+	wallets, _ := wallet.CreateWallets(nodeId, cli.params)
 	addresses := wallets.GetAllAddresses()
 	for _, address := range addresses {
 		fmt.Println(color.Yellow + address)
@@ -92,7 +215,7 @@ func (cli *CommandLine) listAddresses(nodeId string) {
 }
 
 func (cli *CommandLine) printChain(nodeId string) {
-	chain := blockchain.ContinueBlockChain(nodeId)
+	chain := blockchain.ContinueBlockChain(nodeId, cli.params)
 	defer chain.Database.Close()
 	iterator := chain.Iterator()
 	for {
@@ -100,8 +223,8 @@ func (cli *CommandLine) printChain(nodeId string) {
 		fmt.Println()
 		fmt.Printf(color.Cyan + "Previous Hash %x\n", block.PrevHash)
 		fmt.Printf("Hash          %x\n", block.Hash)
-		pow := blockchain.NewProof(block)
-		fmt.Printf("PoW           %s\n" + color.Reset, strconv.FormatBool(pow.Validate()))
+		fmt.Printf("Difficulty    %d\n", block.Difficulty)
+		fmt.Printf("Seal          %s\n" + color.Reset, strconv.FormatBool(chain.CheckBlockHeader(&block.BlockHeader, block.Hash) == nil))
 		for _, tx := range block.Transactions {
 			fmt.Println(tx)
 		}
@@ -112,11 +235,8 @@ func (cli *CommandLine) printChain(nodeId string) {
 	fmt.Println()
 }
 
-func (cli *CommandLine) createBlockChain(address, nodeId string) {
-	if !wallet.ValidateAddress(address) {
-		log.Panic("Address is not valid")
-	}
-	chain := blockchain.InitBlockChain(address, nodeId)
+func (cli *CommandLine) createBlockChain(nodeId string) {
+	chain := blockchain.InitBlockChain(nodeId, cli.params)
 	defer chain.Database.Close()
 	unspentTxOutputsSet := blockchain.UnspentTxOutputsSet{Blockchain: chain}
 	unspentTxOutputsSet.ReIndex()
@@ -124,10 +244,10 @@ func (cli *CommandLine) createBlockChain(address, nodeId string) {
 }
 
 func (cli *CommandLine) getBalance(address, nodeId string) {
-	if !wallet.ValidateAddress(address) {
+	if !wallet.ValidateAddress(address, cli.params) {
 		log.Panic("Address is not valid")
 	}
-	chain := blockchain.ContinueBlockChain(nodeId)
+	chain := blockchain.ContinueBlockChain(nodeId, cli.params)
 	unspentTxOutputsSet := blockchain.UnspentTxOutputsSet{Blockchain: chain}
 	defer chain.Database.Close()
 	balance := 0
@@ -140,24 +260,24 @@ func (cli *CommandLine) getBalance(address, nodeId string) {
 	fmt.Printf("Balance of " + color.Yellow + "%s: " + color.Green + "%d\n", address, balance)
 }
 
-func (cli *CommandLine) send(from, to string, amount int, nodeId string, mineNow bool) {
-	if !wallet.ValidateAddress(to) {
+func (cli *CommandLine) send(from, to string, amount, fee int, nodeId string, mineNow bool) {
+	if !wallet.ValidateAddress(to, cli.params) {
 		log.Panic("To address is not valid")
 	}
-	if !wallet.ValidateAddress(from) {
+	if !wallet.ValidateAddress(from, cli.params) {
 		log.Panic("From address is not valid")
 	}
-	chain := blockchain.ContinueBlockChain(nodeId)
+	chain := blockchain.ContinueBlockChain(nodeId, cli.params)
 	unspentTxOutputsSet := blockchain.UnspentTxOutputsSet{Blockchain: chain}
 	defer chain.Database.Close()
-	wallets := handler.ErrorHandler(wallet.CreateWallets(nodeId))
+	wallets := handler.ErrorHandler(wallet.CreateWallets(nodeId, cli.params))
 	wallet := wallets.GetWallet(from)
-	transaction := blockchain.NewTransaction(&wallet, to, amount, &unspentTxOutputsSet)
+	transaction := blockchain.NewTransaction(&wallet, to, amount, fee, &unspentTxOutputsSet)
 	if mineNow {
-		coinbaseTx := blockchain.CoinbaseTx(from, "")
+		chain.Signer = &wallet
+		coinbaseTx := blockchain.CoinbaseTx(from, "", chain.BlockSubsidy(chain.GetBestHeight()+1)+fee)
 		transactions := []*blockchain.Transaction{coinbaseTx, transaction}
-		block := chain.MineBlock(transactions)
-		unspentTxOutputsSet.Update(block)
+		handler.ErrorHandler(chain.MineBlock(context.Background(), transactions))
 	} else {
 		network.SendTransaction(network.KnownNodes[0], transaction)
 		fmt.Println("Send transaction")
@@ -165,6 +285,25 @@ func (cli *CommandLine) send(from, to string, amount int, nodeId string, mineNow
 	fmt.Println(color.Green + "Success!")
 }
 
+func (cli *CommandLine) generate(address string, blocks int, nodeId string) {
+	if !wallet.ValidateAddress(address, cli.params) {
+		log.Panic("Address is not valid")
+	}
+	chain := blockchain.ContinueBlockChain(nodeId, cli.params)
+	defer chain.Database.Close()
+	if len(chain.Params.Signers) > 0 {
+		wallets := handler.ErrorHandler(wallet.CreateWallets(nodeId, cli.params))
+		signer := wallets.GetWallet(address)
+		chain.Signer = &signer
+	}
+	for i := 0; i < blocks; i++ {
+		coinbaseTx := blockchain.CoinbaseTx(address, "", chain.BlockSubsidy(chain.GetBestHeight()+1))
+		block := handler.ErrorHandler(chain.MineBlock(context.Background(), []*blockchain.Transaction{coinbaseTx}))
+		fmt.Printf("Mined block %d " + color.Cyan + "%x\n" + color.Reset, block.Height, block.Hash)
+	}
+	fmt.Println(color.Green + "Success!")
+}
+
 func (cli *CommandLine) Run() {
 	cli.validateArgs()
 	nodeId := os.Getenv("NODE_ID")
@@ -175,17 +314,35 @@ func (cli *CommandLine) Run() {
 	getBalanceCmd := flag.NewFlagSet(GET_BALANCE_CMD, flag.ExitOnError)
 	createBlockChainCmd := flag.NewFlagSet(CREATE_BLOCKCHAIN_CMD, flag.ExitOnError)
 	sendCmd := flag.NewFlagSet(SEND_CMD, flag.ExitOnError)
+	generateCmd := flag.NewFlagSet(GENERATE_CMD, flag.ExitOnError)
 	printChainCmd := flag.NewFlagSet(PRINT_CHAIN_CMD, flag.ExitOnError)
 	createWalletCmd := flag.NewFlagSet(CREATE_WALLET_CMD, flag.ExitOnError)
 	listAddressesCmd := flag.NewFlagSet(LIST_ADDRESSES_CMD, flag.ExitOnError)
 	reIndexUnspentTxOutputsCmd := flag.NewFlagSet(REINDEX_UTXO_CMD, flag.ExitOnError)
 	startNodeCmd := flag.NewFlagSet(START_NODE_CMD, flag.ExitOnError)
+	getSupplyCmd := flag.NewFlagSet(GET_SUPPLY_CMD, flag.ExitOnError)
+	utxoStatsCmd := flag.NewFlagSet(UTXO_STATS_CMD, flag.ExitOnError)
+	reIndexTransactionsCmd := flag.NewFlagSet(REINDEX_TXINDEX_CMD, flag.ExitOnError)
+	reIndexAddressesCmd := flag.NewFlagSet(REINDEX_ADDRINDEX_CMD, flag.ExitOnError)
+	addressHistoryCmd := flag.NewFlagSet(ADDRESS_HISTORY_CMD, flag.ExitOnError)
+	getMerkleProofCmd := flag.NewFlagSet(GET_MERKLE_PROOF_CMD, flag.ExitOnError)
+	networkName, signers := params.MainNet.Name, ""
+	for _, cmd := range []*flag.FlagSet{getBalanceCmd, createBlockChainCmd, sendCmd, generateCmd, printChainCmd, createWalletCmd, listAddressesCmd, reIndexUnspentTxOutputsCmd, startNodeCmd, getSupplyCmd, utxoStatsCmd, getMerkleProofCmd, reIndexTransactionsCmd, reIndexAddressesCmd, addressHistoryCmd} {
+		cmd.StringVar(&networkName, NETWORK_PARAM, params.MainNet.Name, "Network to use: mainnet, testnet or regtest")
+		cmd.StringVar(&signers, SIGNERS_PARAM, "", "Comma separated signer addresses for proof of authority")
+	}
 	getBalanceAddress := getBalanceCmd.String(ADDRESS_PARAM, "", "The address to get balance for")
-	createBlockChainAddress := createBlockChainCmd.String(ADDRESS_PARAM, "", "The address to send genesis block reward to")
 	sendFrom := sendCmd.String(FROM_PARAM, "", "Source wallet address")
 	sendTo := sendCmd.String(TO_PARAM, "", "Destination wallet address")
 	sendAmount := sendCmd.Int(AMOUNT_PARAM, 0, "Amount to send")
+	sendFee := sendCmd.Int(FEE_PARAM, 0, "Fee paid to the miner")
 	sendMine := sendCmd.Bool(MINE_PARAM, false, "Mine immediately on the same node")
+	generateAddress := generateCmd.String(ADDRESS_PARAM, "", "The address the block rewards are paid to")
+	generateBlocks := generateCmd.Int(BLOCKS_PARAM, 1, "Number of blocks to mine")
+	getMerkleProofTxID := getMerkleProofCmd.String(TXID_PARAM, "", "The id of the transaction to prove")
+	addressHistoryAddress := addressHistoryCmd.String(ADDRESS_PARAM, "", "The address to list the history for")
+	addressHistoryPage := addressHistoryCmd.Int(PAGE_PARAM, 1, "Page to show, starting at 1")
+	addressHistoryPageSize := addressHistoryCmd.Int(PAGE_SIZE_PARAM, 20, "Entries per page")
 	startNodeMiner := startNodeCmd.String(MINER_PARAM, "", "Enable mining mode and send reward to ADDRESS")
 	switch os.Args[1] {
 		case GET_BALANCE_CMD:
@@ -194,6 +351,8 @@ func (cli *CommandLine) Run() {
 			handler.ErrorHandler(createBlockChainCmd.Parse(os.Args[2:]))
 		case SEND_CMD:
 			handler.ErrorHandler(sendCmd.Parse(os.Args[2:]))
+		case GENERATE_CMD:
+			handler.ErrorHandler(generateCmd.Parse(os.Args[2:]))
 		case PRINT_CHAIN_CMD:
 			handler.ErrorHandler(printChainCmd.Parse(os.Args[2:]))
 		case CREATE_WALLET_CMD:
@@ -204,10 +363,29 @@ func (cli *CommandLine) Run() {
 			handler.ErrorHandler(reIndexUnspentTxOutputsCmd.Parse(os.Args[2:]))
 		case START_NODE_CMD:
 			handler.ErrorHandler(startNodeCmd.Parse(os.Args[2:]))
+		case GET_SUPPLY_CMD:
+			handler.ErrorHandler(getSupplyCmd.Parse(os.Args[2:]))
+		case UTXO_STATS_CMD:
+			handler.ErrorHandler(utxoStatsCmd.Parse(os.Args[2:]))
+		case REINDEX_TXINDEX_CMD:
+			handler.ErrorHandler(reIndexTransactionsCmd.Parse(os.Args[2:]))
+		case REINDEX_ADDRINDEX_CMD:
+			handler.ErrorHandler(reIndexAddressesCmd.Parse(os.Args[2:]))
+		case ADDRESS_HISTORY_CMD:
+			handler.ErrorHandler(addressHistoryCmd.Parse(os.Args[2:]))
+		case GET_MERKLE_PROOF_CMD:
+			handler.ErrorHandler(getMerkleProofCmd.Parse(os.Args[2:]))
 		default:
 			cli.printUsage()
 			runtime.Goexit()
 	}
+	cli.params = handler.ErrorHandler(params.Get(networkName))
+	if signers != "" {
+		chainParams := *cli.params
+		chainParams.Signers = strings.Split(signers, ",")
+		cli.params = &chainParams
+	}
+	network.UseParams(cli.params)
 	if getBalanceCmd.Parsed() {
 		if *getBalanceAddress == "" {
 			getBalanceCmd.Usage()
@@ -216,18 +394,21 @@ func (cli *CommandLine) Run() {
 		cli.getBalance(*getBalanceAddress, nodeId)
 	}
 	if createBlockChainCmd.Parsed() {
-		if *createBlockChainAddress == "" {
-			createBlockChainCmd.Usage()
-			runtime.Goexit()
-		}
-		cli.createBlockChain(*createBlockChainAddress, nodeId)
+		cli.createBlockChain(nodeId)
 	}
 	if sendCmd.Parsed() {
-		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 {
+		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 || *sendFee < 0 {
 			sendCmd.Usage()
 			runtime.Goexit()
 		}
-		cli.send(*sendFrom, *sendTo, *sendAmount, nodeId, *sendMine)
+		cli.send(*sendFrom, *sendTo, *sendAmount, *sendFee, nodeId, *sendMine)
+	}
+	if generateCmd.Parsed() {
+		if *generateAddress == "" || *generateBlocks < 1 {
+			generateCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.generate(*generateAddress, *generateBlocks, nodeId)
 	}
 	if printChainCmd.Parsed() {
 		cli.printChain(nodeId)
@@ -241,6 +422,32 @@ func (cli *CommandLine) Run() {
 	if reIndexUnspentTxOutputsCmd.Parsed() {
 		cli.reIndexUnspentTxOutputs(nodeId)
 	}
+	if reIndexTransactionsCmd.Parsed() {
+		cli.reIndexTransactions(nodeId)
+	}
+	if reIndexAddressesCmd.Parsed() {
+		cli.reIndexAddresses(nodeId)
+	}
+	if addressHistoryCmd.Parsed() {
+		if *addressHistoryAddress == "" || *addressHistoryPage < 1 || *addressHistoryPageSize < 1 {
+			addressHistoryCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.addressHistory(*addressHistoryAddress, *addressHistoryPage, *addressHistoryPageSize, nodeId)
+	}
+	if getSupplyCmd.Parsed() {
+		cli.getSupply(nodeId)
+	}
+	if utxoStatsCmd.Parsed() {
+		cli.utxoStats(nodeId)
+	}
+	if getMerkleProofCmd.Parsed() {
+		if *getMerkleProofTxID == "" {
+			getMerkleProofCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.getMerkleProof(*getMerkleProofTxID, nodeId)
+	}
 	if startNodeCmd.Parsed() {
 		cli.StartNode(nodeId, *startNodeMiner)
 	}
@@ -0,0 +1,137 @@
+package network
+
+import "github.com/rodolfoviolla/go-blockchain/blockchain"
+
+// Message payloads use the primitives of the block and transaction encoding,
+// described with the message layouts in docs/serialization.md.
+type message interface {
+	encode(e *blockchain.Encoder)
+	decode(d *blockchain.Decoder)
+}
+
+func encodeMessage(payload message) []byte {
+	e := blockchain.NewEncoder()
+	payload.encode(e)
+	return e.Bytes()
+}
+
+func decodeMessage(data []byte, payload message) error {
+	d := blockchain.NewDecoder(data)
+	if d.Err() != nil {
+		return d.Err()
+	}
+	payload.decode(d)
+	return d.Finish()
+}
+
+func writeList(e *blockchain.Encoder, items [][]byte) {
+	e.WriteCount(len(items))
+	for _, item := range items {
+		e.WriteBytes(item)
+	}
+}
+
+func readList(d *blockchain.Decoder) [][]byte {
+	var items [][]byte
+	count := d.ReadCount()
+	for i := 0; i < count && d.Err() == nil; i++ {
+		items = append(items, d.ReadBytes())
+	}
+	return items
+}
+
+func (a *Address) encode(e *blockchain.Encoder) {
+	e.WriteCount(len(a.AddressList))
+	for _, address := range a.AddressList {
+		e.WriteBytes([]byte(address))
+	}
+}
+
+func (a *Address) decode(d *blockchain.Decoder) {
+	count := d.ReadCount()
+	for i := 0; i < count && d.Err() == nil; i++ {
+		a.AddressList = append(a.AddressList, string(d.ReadBytes()))
+	}
+}
+
+func (b *Block) encode(e *blockchain.Encoder) {
+	e.WriteBytes([]byte(b.AddressFrom))
+	e.WriteBytes(b.Block)
+}
+
+func (b *Block) decode(d *blockchain.Decoder) {
+	b.AddressFrom = string(d.ReadBytes())
+	b.Block = d.ReadBytes()
+}
+
+func (g *GetBlocks) encode(e *blockchain.Encoder) {
+	e.WriteBytes([]byte(g.AddressFrom))
+}
+
+func (g *GetBlocks) decode(d *blockchain.Decoder) {
+	g.AddressFrom = string(d.ReadBytes())
+}
+
+func (g *GetData) encode(e *blockchain.Encoder) {
+	e.WriteBytes([]byte(g.AddressFrom))
+	e.WriteBytes([]byte(g.Type))
+	e.WriteBytes(g.ID)
+}
+
+func (g *GetData) decode(d *blockchain.Decoder) {
+	g.AddressFrom = string(d.ReadBytes())
+	g.Type = string(d.ReadBytes())
+	g.ID = d.ReadBytes()
+}
+
+func (g *GetHeaders) encode(e *blockchain.Encoder) {
+	e.WriteBytes([]byte(g.AddressFrom))
+}
+
+func (g *GetHeaders) decode(d *blockchain.Decoder) {
+	g.AddressFrom = string(d.ReadBytes())
+}
+
+func (h *Headers) encode(e *blockchain.Encoder) {
+	e.WriteBytes([]byte(h.AddressFrom))
+	writeList(e, h.Headers)
+}
+
+func (h *Headers) decode(d *blockchain.Decoder) {
+	h.AddressFrom = string(d.ReadBytes())
+	h.Headers = readList(d)
+}
+
+func (i *Inventory) encode(e *blockchain.Encoder) {
+	e.WriteBytes([]byte(i.AddressFrom))
+	e.WriteBytes([]byte(i.Type))
+	writeList(e, i.Items)
+}
+
+func (i *Inventory) decode(d *blockchain.Decoder) {
+	i.AddressFrom = string(d.ReadBytes())
+	i.Type = string(d.ReadBytes())
+	i.Items = readList(d)
+}
+
+func (t *Transaction) encode(e *blockchain.Encoder) {
+	e.WriteBytes([]byte(t.AddressFrom))
+	e.WriteBytes(t.Transaction)
+}
+
+func (t *Transaction) decode(d *blockchain.Decoder) {
+	t.AddressFrom = string(d.ReadBytes())
+	t.Transaction = d.ReadBytes()
+}
+
+func (v *Version) encode(e *blockchain.Encoder) {
+	e.WriteInt(v.Version)
+	e.WriteInt(v.BestHeight)
+	e.WriteBytes([]byte(v.AddressFrom))
+}
+
+func (v *Version) decode(d *blockchain.Decoder) {
+	v.Version = d.ReadInt()
+	v.BestHeight = d.ReadInt()
+	v.AddressFrom = string(d.ReadBytes())
+}
@@ -2,17 +2,21 @@ package network
 
 import (
 	"bytes"
-	"encoding/gob"
+	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"runtime"
+	"sync"
 	"syscall"
 
 	"github.com/rodolfoviolla/go-blockchain/blockchain"
 	"github.com/rodolfoviolla/go-blockchain/handler"
+	"github.com/rodolfoviolla/go-blockchain/params"
+	"github.com/rodolfoviolla/go-blockchain/wallet"
 	"github.com/vrecan/death/v3"
 )
 
@@ -20,11 +24,14 @@ const (
 	protocol = "tcp"
 	version = 1
 	commandLength = 12
+	maxMessageSize = 32 << 20
 	ADDRESS_CMD = "address"
 	BLOCK_CMD = "block"
 	INVENTORY_CMD = "inventory"
 	GET_BLOCKS_CMD = "get-blocks"
 	GET_DATA_CMD = "get-data"
+	GET_HEADERS_CMD = "get-headers"
+	HEADERS_CMD = "headers"
 	TRANSACTION_CMD = "transaction"
 	VERSION_CMD = "version"
 )
@@ -32,8 +39,11 @@ const (
 var (
 	nodeAddress string
 	mineAddress string
-	KnownNodes = []string{"localhost:3000"}
+	chainParams = &params.MainNet
+	KnownNodes = append([]string{}, chainParams.KnownNodes...)
+	transitMutex sync.Mutex
 	blocksInTransit = [][]byte{}
+	poolMutex sync.Mutex
 	memoryPool = make(map[string]blockchain.Transaction)
 )
 
@@ -56,6 +66,15 @@ type GetData struct {
 	ID []byte
 }
 
+type GetHeaders struct {
+	AddressFrom string
+}
+
+type Headers struct {
+	AddressFrom string
+	Headers [][]byte
+}
+
 type Inventory struct {
 	AddressFrom string
 	Type string
@@ -73,6 +92,11 @@ type Version struct {
 	AddressFrom string
 }
 
+func UseParams(p *params.ChainParams) {
+	chainParams = p
+	KnownNodes = append([]string{}, p.KnownNodes...)
+}
+
 func CmdToBytes(cmd string) []byte {
 	var bytes [commandLength]byte
 	for i, c := range cmd {
@@ -101,20 +125,21 @@ func RequestBlocks() {
 	}
 }
 
-func sendCmd(cmd string, data interface{}, address string) {
-	payload := GobEncode(data)
-	request := append(CmdToBytes(cmd), payload...)
+func sendCmd(cmd string, data message, address string) {
+	payload := encodeMessage(data)
+	request := append(chainParams.Magic[:], CmdToBytes(cmd)...)
+	request = append(request, payload...)
 	SendData(address, request)
 }
 
 func SendAddress(address string) {
-	nodes := Address{KnownNodes}
+	nodes := &Address{KnownNodes}
 	nodes.AddressList = append(nodes.AddressList, nodeAddress)
 	sendCmd(ADDRESS_CMD, nodes, address)
 }
 
 func SendBlock(address string, b *blockchain.Block) {
-	sendCmd(BLOCK_CMD, Block{nodeAddress, b.Serialize()}, address)
+	sendCmd(BLOCK_CMD, &Block{nodeAddress, b.Serialize()}, address)
 }
 
 func SendData(address string, data []byte) {
@@ -135,107 +160,232 @@ func SendData(address string, data []byte) {
 }
 
 func SendInventory(address, kind string, items [][]byte) {
-	sendCmd(INVENTORY_CMD, Inventory{nodeAddress, kind, items}, address)
+	sendCmd(INVENTORY_CMD, &Inventory{nodeAddress, kind, items}, address)
 }
 
 func SendGetBlocks(address string) {
-	sendCmd(GET_BLOCKS_CMD, GetBlocks{nodeAddress}, address)
+	sendCmd(GET_BLOCKS_CMD, &GetBlocks{nodeAddress}, address)
 }
 
 func SendGetData(address, kind string, id []byte) {
-	sendCmd(GET_DATA_CMD, GetData{nodeAddress, kind, id}, address)
+	sendCmd(GET_DATA_CMD, &GetData{nodeAddress, kind, id}, address)
+}
+
+func SendGetHeaders(address string) {
+	sendCmd(GET_HEADERS_CMD, &GetHeaders{nodeAddress}, address)
+}
+
+func SendHeaders(address string, headers [][]byte) {
+	sendCmd(HEADERS_CMD, &Headers{nodeAddress, headers}, address)
 }
 
 func SendTransaction(address string, transaction *blockchain.Transaction) {
-	sendCmd(TRANSACTION_CMD, Transaction{nodeAddress, transaction.Serialize()}, address)
+	sendCmd(TRANSACTION_CMD, &Transaction{nodeAddress, transaction.Serialize()}, address)
 }
 
 func SendVersion(address string, chain *blockchain.BlockChain) {
 	bestHeight := chain.GetBestHeight()
-	sendCmd(VERSION_CMD, Version{version, bestHeight, nodeAddress}, address)
+	sendCmd(VERSION_CMD, &Version{version, bestHeight, nodeAddress}, address)
 }
 
-func getDecodedPayload[T interface{}](request []byte) T {
-	var buff bytes.Buffer
+func getDecodedPayload[T interface{}, P interface{ *T; message }](request []byte) (T, error) {
 	var payload T
-	buff.Write(request[commandLength:])
-	dec := gob.NewDecoder(&buff)
-	handler.ErrorHandler(dec.Decode(&payload))
-	return payload
+	err := decodeMessage(request[commandLength:], P(&payload))
+	return payload, err
 }
 
-func HandleAddress(request []byte) {
-	payload := getDecodedPayload[Address](request)
+func HandleAddress(request []byte) error {
+	payload, err := getDecodedPayload[Address](request)
+	if err != nil {
+		return err
+	}
 	KnownNodes = append(KnownNodes, payload.AddressList...)
 	fmt.Printf("There are %d known nodes\n", len(KnownNodes))
 	RequestBlocks()
+	return nil
 }
 
-func HandleBlock(request []byte, chain*blockchain.BlockChain) {
-	payload := getDecodedPayload[Block](request)
+func HandleBlock(request []byte, chain*blockchain.BlockChain) error {
+	payload, err := getDecodedPayload[Block](request)
+	if err != nil {
+		return err
+	}
 	blockData := payload.Block
-	block := blockchain.Deserialize(blockData)
+	if len(blockData) > blockchain.MaxBlockSize {
+		fmt.Printf("Rejected block of %d bytes\n", len(blockData))
+		return nil
+	}
+	block, err := blockchain.DecodeBlock(blockData)
+	if err != nil {
+		return err
+	}
 	fmt.Println("Received a new block!")
-	chain.AddBlock(block)
-	fmt.Printf("Added block %x\n", block.Hash)
+	if err := chain.AddBlock(block); errors.Is(err, blockchain.ErrUnknownParent) {
+		fmt.Printf("Keeping orphan block %x\n", block.Hash)
+		SendGetData(payload.AddressFrom, BLOCK_CMD, chain.MissingParent(block.Hash))
+	} else if err != nil {
+		fmt.Printf("Rejected block %x: %s\n", block.Hash, err)
+	} else {
+		fmt.Printf("Added block %x\n", block.Hash)
+	}
+	transitMutex.Lock()
+	var blockHash []byte
 	if len(blocksInTransit) > 0 {
-		blockHash := blocksInTransit[0]
-		SendGetData(payload.AddressFrom, BLOCK_CMD, blockHash)
+		blockHash = blocksInTransit[0]
 		blocksInTransit = blocksInTransit[1:]
-	} else {
-		unspentTxOutputsSet := blockchain.UnspentTxOutputsSet{Blockchain: chain}
-		unspentTxOutputsSet.ReIndex()
 	}
+	transitMutex.Unlock()
+	if blockHash != nil {
+		SendGetData(payload.AddressFrom, BLOCK_CMD, blockHash)
+	}
+	return nil
 }
 
-func HandleInventory(request []byte) {
-	payload := getDecodedPayload[Inventory](request)
+func HandleBlockConnected(block *blockchain.Block) {
+	poolMutex.Lock()
+	defer poolMutex.Unlock()
+	for _, tx := range block.Transactions {
+		delete(memoryPool, hex.EncodeToString(tx.ID))
+	}
+}
+
+func HandleHashRate(hashesPerSecond float64) {
+	fmt.Printf("Mining at %.0f H/s\n", hashesPerSecond)
+}
+
+func HandleBlockDisconnected(block *blockchain.Block) {
+	poolMutex.Lock()
+	defer poolMutex.Unlock()
+	for _, tx := range block.Transactions {
+		if !tx.IsCoinbase() {
+			memoryPool[hex.EncodeToString(tx.ID)] = *tx
+		}
+	}
+}
+
+func HandleInventory(request []byte) error {
+	payload, err := getDecodedPayload[Inventory](request)
+	if err != nil {
+		return err
+	}
 	fmt.Printf("Received inventory with %d %s\n", len(payload.Items), payload.Type)
+	if len(payload.Items) == 0 {
+		return nil
+	}
 	if payload.Type == BLOCK_CMD {
-		blocksInTransit = payload.Items
 		blockHash := payload.Items[0]
 		SendGetData(payload.AddressFrom, BLOCK_CMD, blockHash)
 		newInTransit := [][]byte{}
-		for _, b := range blocksInTransit {
+		for _, b := range payload.Items {
 			if !bytes.Equal(b, blockHash) {
 				newInTransit = append(newInTransit, b)
 			}
 		}
+		transitMutex.Lock()
 		blocksInTransit = newInTransit
+		transitMutex.Unlock()
 	}
 	if payload.Type == TRANSACTION_CMD {
 		txID := payload.Items[0]
-		if memoryPool[hex.EncodeToString(txID)].ID == nil {
+		poolMutex.Lock()
+		_, known := memoryPool[hex.EncodeToString(txID)]
+		poolMutex.Unlock()
+		if !known {
 			SendGetData(payload.AddressFrom, TRANSACTION_CMD, txID)
 		}
 	}
+	return nil
 }
 
-func HandleGetBlocks(request []byte, chain*blockchain.BlockChain) {
-	payload := getDecodedPayload[GetBlocks](request)
+func HandleGetBlocks(request []byte, chain*blockchain.BlockChain) error {
+	payload, err := getDecodedPayload[GetBlocks](request)
+	if err != nil {
+		return err
+	}
 	blocks := chain.GetBlockHashes()
+	for i, j := 0, len(blocks)-1; i < j; i, j = i+1, j-1 {
+		blocks[i], blocks[j] = blocks[j], blocks[i]
+	}
 	SendInventory(payload.AddressFrom, BLOCK_CMD, blocks)
+	return nil
+}
+
+func HandleGetHeaders(request []byte, chain*blockchain.BlockChain) error {
+	payload, err := getDecodedPayload[GetHeaders](request)
+	if err != nil {
+		return err
+	}
+	blocks := chain.GetBlockHashes()
+	headers := make([][]byte, 0, len(blocks))
+	for i := len(blocks) - 1; i >= 0; i-- {
+		header := handler.ErrorHandler(chain.GetBlockHeader(blocks[i]))
+		headers = append(headers, header.Serialize())
+	}
+	SendHeaders(payload.AddressFrom, headers)
+	return nil
 }
 
-func HandleGetData(request []byte, chain*blockchain.BlockChain) {
-	payload := getDecodedPayload[GetData](request)
+func HandleHeaders(request []byte, chain*blockchain.BlockChain) error {
+	payload, err := getDecodedPayload[Headers](request)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Received %d headers\n", len(payload.Headers))
+	for _, headerData := range payload.Headers {
+		header, err := blockchain.DecodeHeader(headerData)
+		if err != nil {
+			return err
+		}
+		if err := chain.AddHeader(header, header.Hash()); err != nil {
+			fmt.Printf("Rejected header %x: %s\n", header.Hash(), err)
+			break
+		}
+	}
+	SendGetBlocks(payload.AddressFrom)
+	return nil
+}
+
+func HandleGetData(request []byte, chain*blockchain.BlockChain) error {
+	payload, err := getDecodedPayload[GetData](request)
+	if err != nil {
+		return err
+	}
 	if payload.Type == BLOCK_CMD {
-		block := handler.ErrorHandler(chain.GetBlock([]byte(payload.ID)))
+		block, err := chain.GetBlock(payload.ID)
+		if err != nil {
+			return err
+		}
 		SendBlock(payload.AddressFrom, &block)
 	}
 	if payload.Type == TRANSACTION_CMD {
 		txID := hex.EncodeToString(payload.ID)
+		poolMutex.Lock()
 		tx := memoryPool[txID]
+		poolMutex.Unlock()
 		SendTransaction(payload.AddressFrom, &tx)
 	}
+	return nil
 }
 
-func HandleTransaction(request []byte, chain*blockchain.BlockChain) {
-	payload := getDecodedPayload[Transaction](request)
+func HandleTransaction(request []byte, chain*blockchain.BlockChain) error {
+	payload, err := getDecodedPayload[Transaction](request)
+	if err != nil {
+		return err
+	}
 	txData := payload.Transaction
-	tx := blockchain.DeserializeTransaction(txData)
+	if len(txData) > blockchain.MaxBlockSize - blockchain.BlockReservedSize {
+		fmt.Printf("Rejected transaction of %d bytes\n", len(txData))
+		return nil
+	}
+	tx, err := blockchain.DecodeTransaction(txData)
+	if err != nil {
+		return err
+	}
+	poolMutex.Lock()
 	memoryPool[hex.EncodeToString(tx.ID)] = tx
-	fmt.Printf("%s, %d\n", nodeAddress, len(memoryPool))
+	poolSize := len(memoryPool)
+	poolMutex.Unlock()
+	fmt.Printf("%s, %d\n", nodeAddress, poolSize)
 	if nodeAddress == KnownNodes[0] {
 		for _, node := range KnownNodes {
 			if node != nodeAddress && node != payload.AddressFrom {
@@ -243,75 +393,164 @@ func HandleTransaction(request []byte, chain*blockchain.BlockChain) {
 			}
 		}
 	} else {
-		fmt.Println(len(memoryPool), len(mineAddress))
-		if len(memoryPool) >= 2 && len(mineAddress) > 0 {
+		fmt.Println(poolSize, len(mineAddress))
+		if poolSize >= 2 && len(mineAddress) > 0 {
 			MineTransaction(chain)
 		}
 	}
+	return nil
 }
 
-func MineTransaction(chain *blockchain.BlockChain) {
+var errUnconfirmedParent = errors.New("transaction spends an output of a pool transaction")
+
+// checkPoolTransaction returns the fee of a pool transaction if it can go into
+// the block mined at height next to the transactions already picked, whose
+// spent outpoints are in spent. The caller holds poolMutex.
+func checkPoolTransaction(chain *blockchain.BlockChain, tx *blockchain.Transaction, height int, spent map[string]bool) (int, error) {
+	if err := chain.CheckTransaction(tx); err != nil {
+		return 0, err
+	}
+	unspentTxOutputsSet := blockchain.UnspentTxOutputsSet{Blockchain: chain}
+	fee := 0
+	for _, in := range tx.Inputs {
+		outpoint := fmt.Sprintf("%x:%d", in.ID, in.Out)
+		if spent[outpoint] {
+			return 0, fmt.Errorf("%w: %s", blockchain.ErrDoubleSpend, outpoint)
+		}
+		entry, err := unspentTxOutputsSet.FindOutput(in.ID, in.Out)
+		if err != nil {
+			if _, inPool := memoryPool[hex.EncodeToString(in.ID)]; inPool {
+				return 0, fmt.Errorf("%w: %s", errUnconfirmedParent, outpoint)
+			}
+			return 0, fmt.Errorf("%w: %s", blockchain.ErrMissingInput, outpoint)
+		}
+		if !entry.IsMature(height, chainParams.CoinbaseMaturity) {
+			return 0, fmt.Errorf("%w: %s", blockchain.ErrImmatureCoinbase, outpoint)
+		}
+		fee += entry.Value
+	}
+	for _, out := range tx.Outputs {
+		fee -= out.Value
+	}
+	if fee < 0 {
+		return 0, fmt.Errorf("%w: %x", blockchain.ErrInsufficientInputs, tx.ID)
+	}
+	if !chain.VerifyTransaction(tx) {
+		return 0, fmt.Errorf("%w: %x", blockchain.ErrInvalidSignature, tx.ID)
+	}
+	return fee, nil
+}
+
+// selectPoolTransactions picks the pool transactions that fit in the block
+// mined at height, and drops the ones that can never go into it.
+func selectPoolTransactions(chain *blockchain.BlockChain, height int) ([]*blockchain.Transaction, int) {
+	poolMutex.Lock()
+	defer poolMutex.Unlock()
 	var transactions []*blockchain.Transaction
+	fees, size, sigOps := 0, blockchain.BlockReservedSize, 0
+	spent := make(map[string]bool)
 	for id := range memoryPool {
 		fmt.Printf("Transaction: %s\n", memoryPool[id].ID)
 		tx := memoryPool[id]
-		if chain.VerifyTransaction(&tx) {
-			transactions = append(transactions, &tx)
+		if size+tx.Size() > blockchain.MaxBlockSize || sigOps+tx.SigOpCount() > blockchain.MaxBlockSigOps {
+			continue
+		}
+		fee, err := checkPoolTransaction(chain, &tx, height, spent)
+		if errors.Is(err, errUnconfirmedParent) || errors.Is(err, blockchain.ErrImmatureCoinbase) {
+			continue
 		}
+		if err != nil {
+			fmt.Printf("Dropping transaction %x: %s\n", tx.ID, err)
+			delete(memoryPool, id)
+			continue
+		}
+		for _, in := range tx.Inputs {
+			spent[fmt.Sprintf("%x:%d", in.ID, in.Out)] = true
+		}
+		transactions = append(transactions, &tx)
+		fees += fee
+		size += tx.Size()
+		sigOps += tx.SigOpCount()
 	}
+	return transactions, fees
+}
+
+func MineTransaction(chain *blockchain.BlockChain) {
+	transactions, fees := selectPoolTransactions(chain, chain.GetBestHeight()+1)
 	if len(transactions) == 0 {
 		fmt.Println("All Transactions are valid")
 		return
 	}
-	cbTx := blockchain.CoinbaseTx(mineAddress, "")
-	transactions = append(transactions, cbTx)
-	newBlock := chain.MineBlock(transactions)
-	unspentTxOutputsSet := blockchain.UnspentTxOutputsSet{Blockchain: chain}
-	unspentTxOutputsSet.ReIndex()
-	fmt.Println("New block mined")
-	for _, tx := range transactions {
-		txID := hex.EncodeToString(tx.ID)
-		delete(memoryPool, txID)
+	cbTx := blockchain.CoinbaseTx(mineAddress, "", chain.BlockSubsidy(chain.GetBestHeight()+1)+fees)
+	transactions = append([]*blockchain.Transaction{cbTx}, transactions...)
+	newBlock, err := chain.MineBlock(context.Background(), transactions)
+	if err != nil {
+		fmt.Printf("Could not mine block: %s\n", err)
+		return
 	}
+	fmt.Println("New block mined")
 	for _, node := range KnownNodes {
 		if node != nodeAddress {
 			SendInventory(node, BLOCK_CMD, [][]byte{newBlock.Hash})
 		}
 	}
-	if len(memoryPool) > 0 {
+	poolMutex.Lock()
+	poolSize := len(memoryPool)
+	poolMutex.Unlock()
+	if poolSize > 0 {
 		MineTransaction(chain)
 	}
 }
 
-func HandleVersion(request []byte, chain*blockchain.BlockChain) {
-	payload := getDecodedPayload[Version](request)
+func HandleVersion(request []byte, chain*blockchain.BlockChain) error {
+	payload, err := getDecodedPayload[Version](request)
+	if err != nil {
+		return err
+	}
 	bestHeight := chain.GetBestHeight()
 	otherHeight := payload.BestHeight
 	if bestHeight < otherHeight {
-		SendGetBlocks(payload.AddressFrom)
+		SendGetHeaders(payload.AddressFrom)
 	} else if bestHeight > otherHeight {
 		SendVersion(payload.AddressFrom, chain)
 	}
 	if !NodeIsKnown(payload.AddressFrom) {
 		KnownNodes = append(KnownNodes, payload.AddressFrom)
 	}
+	return nil
 }
 
 func HandleConnection(conn net.Conn, chain *blockchain.BlockChain) {
 	defer conn.Close()
-	req := handler.ErrorHandler(io.ReadAll(conn))
+	req := handler.ErrorHandler(io.ReadAll(io.LimitReader(conn, maxMessageSize+1)))
+	if len(req) > maxMessageSize {
+		fmt.Println("Ignoring oversized message")
+		return
+	}
+	magic := chainParams.Magic[:]
+	if len(req) < len(magic)+commandLength || !bytes.Equal(req[:len(magic)], magic) {
+		fmt.Println("Ignoring message from another network")
+		return
+	}
+	req = req[len(magic):]
 	command := BytesToCmd(req[:commandLength])
 	fmt.Printf("Received %s command\n", command)
+	var err error
 	switch command {
-			case ADDRESS_CMD: HandleAddress(req)
-			case BLOCK_CMD: HandleBlock(req, chain)
-			case INVENTORY_CMD: HandleInventory(req)
-			case GET_BLOCKS_CMD: HandleGetBlocks(req, chain)
-			case GET_DATA_CMD: HandleGetData(req, chain)
-			case TRANSACTION_CMD: HandleTransaction(req, chain)
-			case VERSION_CMD: HandleVersion(req, chain)
+			case ADDRESS_CMD: err = HandleAddress(req)
+			case BLOCK_CMD: err = HandleBlock(req, chain)
+			case INVENTORY_CMD: err = HandleInventory(req)
+			case GET_BLOCKS_CMD: err = HandleGetBlocks(req, chain)
+			case GET_DATA_CMD: err = HandleGetData(req, chain)
+			case GET_HEADERS_CMD: err = HandleGetHeaders(req, chain)
+			case HEADERS_CMD: err = HandleHeaders(req, chain)
+			case TRANSACTION_CMD: err = HandleTransaction(req, chain)
+			case VERSION_CMD: err = HandleVersion(req, chain)
 			default: fmt.Println("Unknown command")
 	}
+	if err != nil {
+		fmt.Printf("Ignoring %s command: %s\n", command, err)
+	}
 }
 
 func StartServer(nodeID, minerAddress string) {
@@ -319,8 +558,16 @@ func StartServer(nodeID, minerAddress string) {
 	mineAddress = minerAddress
 	listener := handler.ErrorHandler(net.Listen(protocol, nodeAddress))
 	defer listener.Close()
-	chain := blockchain.ContinueBlockChain(nodeID)
+	chain := blockchain.ContinueBlockChain(nodeID, chainParams)
 	defer chain.Database.Close()
+	chain.OnBlockConnected = HandleBlockConnected
+	chain.OnBlockDisconnected = HandleBlockDisconnected
+	chain.OnHashRate = HandleHashRate
+	if len(mineAddress) > 0 && len(chain.Params.Signers) > 0 {
+		wallets := handler.ErrorHandler(wallet.CreateWallets(nodeID, chainParams))
+		signer := wallets.GetWallet(mineAddress)
+		chain.Signer = &signer
+	}
 	go CloseDB(chain)
 	if nodeAddress != KnownNodes[0] {
 		SendVersion(KnownNodes[0], chain)
@@ -331,13 +578,6 @@ func StartServer(nodeID, minerAddress string) {
 	}
 }
 
-func GobEncode(data interface{}) []byte {
-	var buff bytes.Buffer
-	enc := gob.NewEncoder(&buff)
-	handler.ErrorHandler(enc.Encode(data))
-	return buff.Bytes()
-}
-
 func NodeIsKnown(address string) bool {
 	for _, node := range KnownNodes {
 		if node == address {
@@ -0,0 +1,176 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/rodolfoviolla/go-blockchain/blockchain"
+	"github.com/rodolfoviolla/go-blockchain/params"
+	"github.com/rodolfoviolla/go-blockchain/wallet"
+)
+
+func newTestNode(t *testing.T) *blockchain.BlockChain {
+	t.Helper()
+	chainParams := params.RegTest
+	chainParams.DataDir = t.TempDir()
+	UseParams(&chainParams)
+	nodeAddress = KnownNodes[0]
+	memoryPool = make(map[string]blockchain.Transaction)
+	chain := blockchain.InitBlockChain("test", &chainParams)
+	t.Cleanup(func() { chain.Database.Close() })
+	chain.OnBlockConnected = HandleBlockConnected
+	chain.OnBlockDisconnected = HandleBlockDisconnected
+	unspentTxOutputsSet := blockchain.UnspentTxOutputsSet{Blockchain: chain}
+	unspentTxOutputsSet.ReIndex()
+	return chain
+}
+
+// mineMatureFunds mines enough blocks paying w for the first one to be spendable.
+func mineMatureFunds(t *testing.T, chain *blockchain.BlockChain, w *wallet.Wallet) {
+	t.Helper()
+	for i := 0; i <= chainParams.CoinbaseMaturity; i++ {
+		coinbase := blockchain.CoinbaseTx(string(w.Address(chainParams)), "", chain.BlockSubsidy(chain.GetBestHeight()+1))
+		if _, err := chain.MineBlock(context.Background(), []*blockchain.Transaction{coinbase}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMineTransactionDropsConflictingTransactions(t *testing.T) {
+	chain := newTestNode(t)
+	w1, w2 := wallet.MakeWallet(), wallet.MakeWallet()
+	mineMatureFunds(t, chain, w1)
+	unspentTxOutputsSet := blockchain.UnspentTxOutputsSet{Blockchain: chain}
+	tx := blockchain.NewTransaction(w1, string(w2.Address(chainParams)), 5, 0, &unspentTxOutputsSet)
+	conflicting := blockchain.NewTransaction(w1, string(w2.Address(chainParams)), 6, 0, &unspentTxOutputsSet)
+	missing := *tx
+	missing.Inputs = append([]blockchain.TxInput{}, tx.Inputs...)
+	missing.Inputs[0].Out = 7
+	missing.ID = missing.Hash()
+	height := chain.GetBestHeight()
+	if _, err := checkPoolTransaction(chain, &missing, height+1, map[string]bool{}); !errors.Is(err, blockchain.ErrMissingInput) {
+		t.Fatalf("missing input: got %v, want %v", err, blockchain.ErrMissingInput)
+	}
+	spent := map[string]bool{fmt.Sprintf("%x:%d", tx.Inputs[0].ID, tx.Inputs[0].Out): true}
+	if _, err := checkPoolTransaction(chain, conflicting, height+1, spent); !errors.Is(err, blockchain.ErrDoubleSpend) {
+		t.Fatalf("conflicting input: got %v, want %v", err, blockchain.ErrDoubleSpend)
+	}
+	for _, poolTx := range []*blockchain.Transaction{tx, conflicting, &missing} {
+		memoryPool[hex.EncodeToString(poolTx.ID)] = *poolTx
+	}
+	mineAddress = string(w2.Address(chainParams))
+	MineTransaction(chain)
+	if chain.GetBestHeight() != height+1 {
+		t.Fatalf("height %d, want %d", chain.GetBestHeight(), height+1)
+	}
+	if len(memoryPool) != 0 {
+		t.Fatalf("%d transactions left in the pool", len(memoryPool))
+	}
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	messages := []message{
+		&Address{[]string{"localhost:3000", "localhost:3001"}},
+		&Block{"localhost:3000", []byte{1, 2, 3}},
+		&GetBlocks{"localhost:3000"},
+		&GetData{"localhost:3000", BLOCK_CMD, []byte{4, 5}},
+		&GetHeaders{"localhost:3000"},
+		&Headers{"localhost:3000", [][]byte{{6}, {7, 8}}},
+		&Inventory{"localhost:3000", TRANSACTION_CMD, [][]byte{{9}}},
+		&Transaction{"localhost:3000", []byte{10}},
+		&Version{version, 42, "localhost:3000"},
+	}
+	for _, sent := range messages {
+		received := reflect.New(reflect.TypeOf(sent).Elem()).Interface().(message)
+		if err := decodeMessage(encodeMessage(sent), received); err != nil {
+			t.Fatalf("%T: %s", sent, err)
+		}
+		if !reflect.DeepEqual(sent, received) {
+			t.Errorf("sent %+v, received %+v", sent, received)
+		}
+	}
+}
+
+func TestHandlersRejectMalformedPayloads(t *testing.T) {
+	chain := newTestNode(t)
+	block, err := chain.GetBlock(chain.LastHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis := block.Serialize()
+	truncated := append(CmdToBytes(BLOCK_CMD), encodeMessage(&Block{"localhost:3001", genesis[:len(genesis)-1]})...)
+	if err := HandleBlock(truncated, chain); !errors.Is(err, blockchain.ErrMalformedData) {
+		t.Errorf("truncated block: got %v, want %v", err, blockchain.ErrMalformedData)
+	}
+	envelope := encodeMessage(&Transaction{"localhost:3001", []byte{1}})
+	request := append(CmdToBytes(TRANSACTION_CMD), envelope[:len(envelope)-1]...)
+	if err := HandleTransaction(request, chain); !errors.Is(err, blockchain.ErrMalformedData) {
+		t.Errorf("truncated envelope: got %v, want %v", err, blockchain.ErrMalformedData)
+	}
+	headers := append(CmdToBytes(HEADERS_CMD), encodeMessage(&Headers{"localhost:3001", [][]byte{{2, 0}}})...)
+	if err := HandleHeaders(headers, chain); !errors.Is(err, blockchain.ErrEncodingVersion) {
+		t.Errorf("bad header version: got %v, want %v", err, blockchain.ErrEncodingVersion)
+	}
+	if len(memoryPool) != 0 || chain.GetBestHeight() != 0 {
+		t.Fatal("a malformed payload changed the node state")
+	}
+}
+
+func TestPoolChangesWhileMining(t *testing.T) {
+	chain := newTestNode(t)
+	w1, w2 := wallet.MakeWallet(), wallet.MakeWallet()
+	mineMatureFunds(t, chain, w1)
+	unspentTxOutputsSet := blockchain.UnspentTxOutputsSet{Blockchain: chain}
+	tx := blockchain.NewTransaction(w1, string(w2.Address(chainParams)), 5, 0, &unspentTxOutputsSet)
+	memoryPool[hex.EncodeToString(tx.ID)] = *tx
+	mineAddress = string(w2.Address(chainParams))
+	disconnected := &blockchain.Block{Transactions: []*blockchain.Transaction{tx}}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			HandleBlockDisconnected(disconnected)
+			HandleBlockConnected(disconnected)
+		}
+	}()
+	MineTransaction(chain)
+	<-done
+}
+
+func TestHandleBlockRejectsOversizedBlocks(t *testing.T) {
+	chain := newTestNode(t)
+	request := append(CmdToBytes(BLOCK_CMD), encodeMessage(&Block{"localhost:3001", make([]byte, blockchain.MaxBlockSize+1)})...)
+	if err := HandleBlock(request, chain); err != nil {
+		t.Fatalf("oversized block was decoded: %s", err)
+	}
+	if chain.GetBestHeight() != 0 {
+		t.Fatal("oversized block changed the chain")
+	}
+}
+
+func TestMinerStopsAtBlockLimits(t *testing.T) {
+	chain := newTestNode(t)
+	w1, w2 := wallet.MakeWallet(), wallet.MakeWallet()
+	mineMatureFunds(t, chain, w1)
+	unspentTxOutputsSet := blockchain.UnspentTxOutputsSet{Blockchain: chain}
+	tx := blockchain.NewTransaction(w1, string(w2.Address(chainParams)), 5, 0, &unspentTxOutputsSet)
+	large := blockchain.Transaction{Inputs: []blockchain.TxInput{{PubKey: make([]byte, blockchain.MaxBlockSize)}}}
+	large.ID = large.Hash()
+	manySigOps := blockchain.Transaction{Inputs: make([]blockchain.TxInput, blockchain.MaxBlockSigOps+1)}
+	manySigOps.ID = manySigOps.Hash()
+	for _, poolTx := range []*blockchain.Transaction{tx, &large, &manySigOps} {
+		memoryPool[hex.EncodeToString(poolTx.ID)] = *poolTx
+	}
+	transactions, _ := selectPoolTransactions(chain, chain.GetBestHeight()+1)
+	if len(transactions) != 1 || !bytes.Equal(transactions[0].ID, tx.ID) {
+		t.Fatalf("picked %d transactions, want only %x", len(transactions), tx.ID)
+	}
+	if len(memoryPool) != 3 {
+		t.Fatalf("%d transactions left in the pool, want all 3 kept", len(memoryPool))
+	}
+}
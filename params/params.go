@@ -0,0 +1,117 @@
+package params
+
+import "fmt"
+
+type ChainParams struct {
+	Name string
+	Magic [4]byte
+	DataDir string
+	KnownNodes []string
+	AddressVersion byte
+	GenesisData string
+	GenesisTimestamp int64
+	GenesisNonce int
+	GenesisPubKeyHash string
+	GenesisHash string
+	InitialDifficulty int
+	MinDifficulty int
+	NoRetargeting bool
+	RetargetInterval int
+	TargetBlockTime int
+	InitialSubsidy int
+	HalvingInterval int
+	CoinbaseMaturity int
+	MaxFutureBlockTime int64
+	Checkpoints map[int]string
+	AssumeValid string
+	Signers []string
+}
+
+var MainNet = ChainParams{
+	Name: "mainnet",
+	Magic: [4]byte{0xf9, 0xbe, 0xb4, 0xd9},
+	DataDir: "./tmp",
+	KnownNodes: []string{"localhost:3000"},
+	AddressVersion: 0x00,
+	GenesisData: "First Transaction from Genesis",
+	GenesisTimestamp: 1684108800,
+	GenesisNonce: 5098,
+	GenesisPubKeyHash: "0000000000000000000000000000000000000000",
+	GenesisHash: "000b0967a11ee044c17dd2079d4187f693c48295a9f9c5b3e40914a6b9376ae9",
+	InitialDifficulty: 12,
+	MinDifficulty: 8,
+	RetargetInterval: 10,
+	TargetBlockTime: 10,
+	InitialSubsidy: 20,
+	HalvingInterval: 100,
+	CoinbaseMaturity: 10,
+	MaxFutureBlockTime: 2 * 60 * 60,
+	Checkpoints: map[int]string{
+		0: "000b0967a11ee044c17dd2079d4187f693c48295a9f9c5b3e40914a6b9376ae9",
+	},
+}
+
+var TestNet = ChainParams{
+	Name: "testnet",
+	Magic: [4]byte{0x0b, 0x11, 0x09, 0x07},
+	DataDir: "./tmp/testnet",
+	KnownNodes: []string{"localhost:4000"},
+	AddressVersion: 0x6f,
+	GenesisData: "First Transaction from Testnet Genesis",
+	GenesisTimestamp: 1684195200,
+	GenesisNonce: 360,
+	GenesisPubKeyHash: "0000000000000000000000000000000000000000",
+	GenesisHash: "00406c485b1885808243c6825573329ff3e0c2845783672475768006b4f911fa",
+	InitialDifficulty: 8,
+	MinDifficulty: 4,
+	RetargetInterval: 10,
+	TargetBlockTime: 10,
+	InitialSubsidy: 20,
+	HalvingInterval: 100,
+	CoinbaseMaturity: 10,
+	MaxFutureBlockTime: 2 * 60 * 60,
+	Checkpoints: map[int]string{
+		0: "00406c485b1885808243c6825573329ff3e0c2845783672475768006b4f911fa",
+	},
+}
+
+var RegTest = ChainParams{
+	Name: "regtest",
+	Magic: [4]byte{0xfa, 0xbf, 0xb5, 0xda},
+	DataDir: "./tmp/regtest",
+	KnownNodes: []string{"localhost:5000"},
+	AddressVersion: 0xc4,
+	GenesisData: "First Transaction from Regtest Genesis",
+	GenesisTimestamp: 1684281600,
+	GenesisNonce: 5,
+	GenesisPubKeyHash: "0000000000000000000000000000000000000000",
+	GenesisHash: "40d9d75803115743449cc77c9bcba22df997e8c2a206be621fdf91e41cbaeac4",
+	InitialDifficulty: 1,
+	MinDifficulty: 1,
+	NoRetargeting: true,
+	RetargetInterval: 10,
+	TargetBlockTime: 10,
+	InitialSubsidy: 20,
+	HalvingInterval: 150,
+	CoinbaseMaturity: 10,
+	MaxFutureBlockTime: 2 * 60 * 60,
+}
+
+var networks = []*ChainParams{&MainNet, &TestNet, &RegTest}
+
+func Get(name string) (*ChainParams, error) {
+	for _, network := range networks {
+		if network.Name == name {
+			return network, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown network %q", name)
+}
+
+func (p *ChainParams) BlocksPath(nodeId string) string {
+	return fmt.Sprintf("%s/blocks_%s", p.DataDir, nodeId)
+}
+
+func (p *ChainParams) WalletsPath(nodeId string) string {
+	return fmt.Sprintf("%s/wallets_%s.data", p.DataDir, nodeId)
+}
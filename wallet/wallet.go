@@ -8,31 +8,35 @@ import (
 	"crypto/sha256"
 
 	"github.com/rodolfoviolla/go-blockchain/handler"
+	"github.com/rodolfoviolla/go-blockchain/params"
 	"golang.org/x/crypto/ripemd160"
 )
 
-const (
-	checksumLength = 4
-	version = byte(0x00)
-)
+const checksumLength = 4
 
 type Wallet struct {
 	PrivateKey ecdsa.PrivateKey
 	PublicKey []byte
 }
 
-func (w Wallet) Address() []byte {
+func (w Wallet) Address(chainParams *params.ChainParams) []byte {
 	pubHash := PublicKeyHash(w.PublicKey)
-	versionedHash := append([]byte{version}, pubHash...)
+	versionedHash := append([]byte{chainParams.AddressVersion}, pubHash...)
 	checksum := Checksum(versionedHash)
 	fullHash := append(versionedHash, checksum...)
 	return Base58Encode(fullHash)
 }
 
-func ValidateAddress(address string) bool {
+func ValidateAddress(address string, chainParams *params.ChainParams) bool {
 	pubKeyHash := Base58Decode([]byte(address))
+	if len(pubKeyHash) <= checksumLength {
+		return false
+	}
 	actualChecksum := pubKeyHash[len(pubKeyHash)-checksumLength:]
 	version := pubKeyHash[0]
+	if version != chainParams.AddressVersion {
+		return false
+	}
 	pubKeyHash = pubKeyHash[1:len(pubKeyHash)-checksumLength]
 	targetChecksum := Checksum(append([]byte{version}, pubKeyHash...))
 	return bytes.Equal(actualChecksum, targetChecksum)
@@ -4,27 +4,27 @@ import (
 	"bytes"
 	"crypto/elliptic"
 	"encoding/gob"
-	"fmt"
 	"os"
 
 	"github.com/rodolfoviolla/go-blockchain/handler"
+	"github.com/rodolfoviolla/go-blockchain/params"
 )
 
-const walletFile = "./tmp/wallets_%s.data"
-
 type Wallets struct {
 	Wallets map[string]*Wallet
+	params *params.ChainParams
 }
 
-func CreateWallets(nodeId string) (*Wallets, error) {
+func CreateWallets(nodeId string, chainParams *params.ChainParams) (*Wallets, error) {
 	wallets := Wallets{}
 	wallets.Wallets = make(map[string]*Wallet)
+	wallets.params = chainParams
 	return &wallets, wallets.LoadFile(nodeId)
 }
 
 func (ws *Wallets) AddWallet() string {
 	wallet := MakeWallet()
-	address := string(wallet.Address())
+	address := string(wallet.Address(ws.params))
 	ws.Wallets[address] = wallet
 	return address
 }
@@ -42,7 +42,7 @@ func (ws Wallets) GetWallet(address string) Wallet {
 }
 
 func (ws *Wallets) LoadFile(nodeId string) error {
-	walletFile := fmt.Sprintf(walletFile, nodeId)
+	walletFile := ws.params.WalletsPath(nodeId)
 	if _, err := os.Stat(walletFile); os.IsNotExist(err) {
 		return err
 	}
@@ -63,7 +63,8 @@ func (ws *Wallets) LoadFile(nodeId string) error {
 
 func (ws *Wallets) SaveFile(nodeId string) {
 	var content bytes.Buffer
-	walletFile := fmt.Sprintf(walletFile, nodeId)
+	walletFile := ws.params.WalletsPath(nodeId)
+	handler.ErrorHandler(os.MkdirAll(ws.params.DataDir, 0755))
 	gob.Register(elliptic.P256())
 	encoder := gob.NewEncoder(&content)
 	handler.ErrorHandler(encoder.Encode(ws))